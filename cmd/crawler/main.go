@@ -1,44 +1,89 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"webcrawler/internal/api"
 	"webcrawler/internal/config"
 	"webcrawler/internal/crawler"
-	"webcrawler/internal/queue"
-	"webcrawler/internal/robots"
-	"webcrawler/internal/stats"
+	"webcrawler/internal/extract"
+	"webcrawler/internal/jobs"
+	"webcrawler/internal/metrics"
 	"webcrawler/internal/storage"
 )
 
 func main() {
-	cfg := config.Load()
+	cfg, err := config.Load(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+
+	// The first SIGINT or SIGTERM shuts down gracefully, a second one kills
+	// the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pipeline := extract.DefaultPipeline()
+	if cfg.ExtractRules != "" {
+		ruleStage, err := extract.LoadRuleStage(cfg.ExtractRules)
+		if err != nil {
+			fmt.Println("Error loading extraction rules:", err)
+			os.Exit(1)
+		}
+		pipeline.Register(ruleStage)
+	}
 
 	db := storage.NewMongoDB(cfg.DBAccess, cfg.MongoURI)
+	db.SetClearOnConnect(cfg.ClearDB && !cfg.Recrawl && !cfg.Resume)
 	db.Connect()
 
-	crawled := queue.NewCrawledSet()
-	q := queue.NewQueue()
-	robotsChecker := robots.NewRobotsChecker(cfg.UserAgent)
-	crawlerStats := stats.NewCrawlerStats()
+	jobManager := jobs.NewManager(cfg, db, crawler.NewServices(cfg, pipeline), cfg.MaxActiveJobs)
+	defaultJob, err := jobManager.Create(jobs.DefaultJob)
+	if err != nil {
+		fmt.Println("Error creating default job:", err)
+		os.Exit(1)
+	}
+	metrics.SetQueueDepth(func() map[string]int {
+		sizes := make(map[string]int)
+		for _, job := range jobManager.List() {
+			sizes[job.Name] = job.Crawler.Run().Queue.Size()
+		}
+		return sizes
+	})
 
 	// Start API server in goroutine
-	apiServer := api.NewAPIServer(db, crawlerStats, crawled, q)
-	go apiServer.Start("8080")
+	apiServer := api.NewAPIServer(db, jobManager)
+	go func() {
+		if err := apiServer.Start(strconv.Itoa(cfg.APIPort)); err != nil {
+			fmt.Println("Error starting API server:", err)
+			os.Exit(1)
+		}
+	}()
 
-	ticker := time.NewTicker(1 * time.Minute)
+	ticker := time.NewTicker(cfg.StatsInterval)
 	done := make(chan bool)
 
-	// Tick every minute and broadcast stats
+	// Sample every job's stats and broadcast them
 	go func() {
 		for {
 			select {
 			case <-done:
 				return
 			case t := <-ticker.C:
-				crawlerStats.Update(crawled, q, t)
+				for _, job := range jobManager.List() {
+					job.Crawler.Run().RecordStats(t)
+				}
 				apiServer.BroadcastStats()
 			}
 		}
@@ -57,55 +102,50 @@ func main() {
 		}
 	}()
 
-	q.Enqueue(cfg.SeedURL, crawled)
-	url := q.Dequeue()
-	crawled.Add(url)
-	c := make(chan []byte)
-
-	// Check robots.txt before fetching
-	if allowed, crawlDelay := robotsChecker.IsAllowed(url); allowed {
-		if crawlDelay > 0 {
-			time.Sleep(crawlDelay)
+	// Crawl the configured seeds right away; without them the crawl is
+	// started through the API
+	if settings := defaultJob.Crawler.DefaultSettings(); len(settings.Seeds) > 0 {
+		if err := jobManager.Start(jobs.DefaultJob, settings); err != nil {
+			fmt.Println("Error starting crawl:", err)
+			os.Exit(1)
 		}
-		go crawler.FetchPage(url, c)
+	}
 
-		content := <-c
-		crawler.ParsePage(url, content, q, crawled, db, robotsChecker)
-	} else {
-		fmt.Printf("Robots.txt disallows crawling: %s\n", url)
-		c <- []byte("") // Send empty content to continue flow
+	if cfg.ExitWhenDone {
+		go func() {
+			jobManager.Wait()
+			stop()
+		}()
 	}
 
-	for q.Size() > 0 && crawled.Size() < 5000 {
-		url := q.Dequeue()
-		crawled.Add(url)
+	<-ctx.Done()
+	stop()
+	fmt.Println("Shutting down")
 
-		// Check robots.txt before fetching
-		allowed, crawlDelay := robotsChecker.IsAllowed(url)
-		if !allowed {
-			fmt.Printf("Robots.txt disallows crawling: %s\n", url)
-			continue
-		}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := apiServer.Shutdown(shutdownCtx); err != nil {
+		fmt.Println("Error shutting down API server:", err)
+	}
+	cancel()
 
-		// Respect crawl delay
-		if crawlDelay > 0 {
-			time.Sleep(crawlDelay)
-		}
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.DrainTimeout)
+	if err := jobManager.Shutdown(drainCtx); err != nil {
+		fmt.Println("Crawls did not finish in time:", err)
+	}
+	cancel()
 
-		go crawler.FetchPage(url, c)
-		content := <-c
-		if len(content) == 0 {
-			continue
-		}
-		crawler.ParsePage(url, content, q, crawled, db, robotsChecker)
+	// A frontier that could not be saved is lost, which fails the exit
+	exitCode := 0
+	if err := jobManager.SaveErrors(); err != nil {
+		fmt.Println("Error saving frontiers:", err)
+		exitCode = 1
 	}
 
 	ticker.Stop()
-	done <- true
-	db.Disconnect()
-	fmt.Println("\n------------------CRAWLER STATS------------------")
-	fmt.Printf("Total queued: %d\n", q.TotalQueued())
-	fmt.Printf("To be crawled (Queue) size: %d\n", q.Size())
-	fmt.Printf("Crawled size: %d\n", crawled.Size())
-	crawlerStats.Print()
+	close(done)
+
+	disconnectCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	db.Disconnect(disconnectCtx)
+	cancel()
+	os.Exit(exitCode)
 }
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"webcrawler/internal/crawler"
+	"webcrawler/internal/jobs"
+	"webcrawler/internal/seeds"
+	"webcrawler/internal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+type CreateJobRequest struct {
+	Name string `json:"name"`
+	crawler.Settings
+}
+
+type JobsResponse struct {
+	Jobs []jobs.Info `json:"jobs"`
+}
+
+type SeedsRequest struct {
+	URLs []seeds.Seed `json:"urls"` // URL strings, or objects with a depth and scope of their own
+}
+
+type SeedsResponse struct {
+	Added    []string               `json:"added"`
+	Rejected []crawler.RejectedSeed `json:"rejected"`
+}
+
+// job returns the job named in the path or the job query parameter, or
+// the default job. It writes a 404 if there is no such job.
+func (s *APIServer) job(w http.ResponseWriter, r *http.Request) (*jobs.Job, bool) {
+	name := mux.Vars(r)["name"]
+	if name == "" {
+		name = r.URL.Query().Get("job")
+	}
+	if name == "" {
+		name = jobs.DefaultJob
+	}
+
+	job, ok := s.jobs.Get(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no job "+name)
+	}
+	return job, ok
+}
+
+func (s *APIServer) defaultJob() *jobs.Job {
+	job, _ := s.jobs.Get(jobs.DefaultJob)
+	return job
+}
+
+// namespace returns the storage of the job named in the job query
+// parameter, or of all jobs.
+func (s *APIServer) namespace(r *http.Request) *storage.MongoDB {
+	if name := r.URL.Query().Get("job"); name != "" {
+		return s.storage.Namespace(name)
+	}
+	return s.storage
+}
+
+func (s *APIServer) handleJobs(w http.ResponseWriter, r *http.Request) {
+	response := JobsResponse{Jobs: []jobs.Info{}}
+	for _, job := range s.jobs.List() {
+		response.Jobs = append(response.Jobs, s.jobs.Info(job))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleCreateJob creates a job and starts it, or queues it while the
+// maximum number of jobs is active. Settings missing from the body keep
+// the configured defaults, except for the seeds.
+func (s *APIServer) handleCreateJob(w http.ResponseWriter, r *http.Request) {
+	request := CreateJobRequest{Settings: s.defaultJob().Crawler.DefaultSettings()}
+	request.Seeds = nil
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid job: "+err.Error())
+		return
+	}
+	if err := crawler.ValidateSettings(request.Settings); err != nil {
+		writeCrawlError(w, err)
+		return
+	}
+
+	job, err := s.jobs.CreateAndStart(request.Name, request.Settings)
+	if err != nil {
+		writeCrawlError(w, err)
+		return
+	}
+	s.writeJobInfo(w, job, http.StatusCreated)
+}
+
+func (s *APIServer) handleCrawlStatus(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+	s.writeJobInfo(w, job, http.StatusOK)
+}
+
+// handleCrawlStart starts a crawl of the job. Settings missing from the
+// body keep the configured defaults, and an empty body crawls the
+// configured seeds.
+func (s *APIServer) handleCrawlStart(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+
+	settings := job.Crawler.DefaultSettings()
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid settings: "+err.Error())
+			return
+		}
+	}
+
+	if err := s.jobs.Start(job.Name, settings); err != nil {
+		writeCrawlError(w, err)
+		return
+	}
+	s.writeJobInfo(w, job, http.StatusAccepted)
+}
+
+func (s *APIServer) handleCrawlPause(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+	if err := job.Crawler.Pause(); err != nil {
+		writeCrawlError(w, err)
+		return
+	}
+	s.writeJobInfo(w, job, http.StatusOK)
+}
+
+func (s *APIServer) handleCrawlResume(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+	if err := job.Crawler.Resume(); err != nil {
+		writeCrawlError(w, err)
+		return
+	}
+	s.writeJobInfo(w, job, http.StatusOK)
+}
+
+func (s *APIServer) handleCrawlStop(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+	if err := s.jobs.Stop(job.Name); err != nil {
+		writeCrawlError(w, err)
+		return
+	}
+	s.writeJobInfo(w, job, http.StatusAccepted)
+}
+
+func (s *APIServer) handleCrawlSeeds(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+
+	var request SeedsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	if len(request.URLs) == 0 {
+		writeError(w, http.StatusBadRequest, "no urls given")
+		return
+	}
+
+	added, rejected, err := job.Crawler.AddSeeds(request.URLs)
+	if err != nil {
+		writeCrawlError(w, err)
+		return
+	}
+
+	response := SeedsResponse{
+		Added:    append([]string{}, added...),
+		Rejected: append([]crawler.RejectedSeed{}, rejected...),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *APIServer) writeJobInfo(w http.ResponseWriter, job *jobs.Job, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(s.jobs.Info(job))
+}
+
+// writeCrawlError reports state conflicts as 409 and invalid settings as 400.
+func writeCrawlError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, crawler.ErrActive), errors.Is(err, crawler.ErrNotActive),
+		errors.Is(err, crawler.ErrNotRunning), errors.Is(err, crawler.ErrNotPaused),
+		errors.Is(err, jobs.ErrJobExists):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, jobs.ErrJobNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	default:
+		writeError(w, http.StatusBadRequest, err.Error())
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"webcrawler/internal/events"
+)
+
+const (
+	eventBuffer    = 256              // Events queued per stream
+	eventHeartbeat = 15 * time.Second // Comment sent to keep idle streams open
+)
+
+// eventFilter reads the comma separated type, host and job parameters.
+func eventFilter(r *http.Request) (events.Filter, error) {
+	query := r.URL.Query()
+	list := func(name string) []string {
+		var result []string
+		for _, value := range query[name] {
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					result = append(result, item)
+				}
+			}
+		}
+		return result
+	}
+	return events.NewFilter(list("type"), list("host"), list("job"))
+}
+
+// handleEventsWebSocket sends the crawl events passing the filter given by
+// the type, host and job parameters.
+func (s *APIServer) handleEventsWebSocket(w http.ResponseWriter, r *http.Request) {
+	filter, err := eventFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("WebSocket upgrade error:", err)
+		return
+	}
+	s.hub.Serve(conn, []string{TopicEvents}, true, filter, nil)
+}
+
+// handleEvents streams the crawl events passing the filter as Server-Sent
+// Events named after their type. Events are dropped while the client is
+// behind.
+func (s *APIServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := eventFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	stream := make(chan events.Event, eventBuffer)
+	unsubscribe := s.jobs.Services().Events.Subscribe(func(event events.Event) {
+		if !filter.Match(event) {
+			return
+		}
+		select {
+		case stream <- event:
+		default:
+		}
+	})
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event := <-stream:
+			data, err := json.Marshal(event)
+			if err != nil {
+				fmt.Println("Error encoding event:", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"webcrawler/internal/stats"
+
+	"github.com/gorilla/mux"
+)
+
+// HostResponse combines a host's fetch counters with its throttling state
+// and how many of its URLs are waiting in the frontiers of all jobs.
+type HostResponse struct {
+	stats.HostCounters
+	DelaySeconds     float64    `json:"delaySeconds"`               // Current delay between requests
+	CircuitOpenUntil *time.Time `json:"circuitOpenUntil,omitempty"` // Set while the host is paused after repeated failures
+	Backlog          int        `json:"backlog"`
+}
+
+type HostsResponse struct {
+	Hosts       []HostResponse `json:"hosts"`
+	TotalCount  int            `json:"totalCount"`
+	CurrentPage int            `json:"currentPage"`
+	TotalPages  int            `json:"totalPages"`
+}
+
+// hostSorts orders hosts by a field in ascending order.
+var hostSorts = map[string]func(a, b HostResponse) bool{
+	"host":    func(a, b HostResponse) bool { return a.Host < b.Host },
+	"pages":   func(a, b HostResponse) bool { return a.Pages < b.Pages },
+	"errors":  func(a, b HostResponse) bool { return a.Errors < b.Errors },
+	"bytes":   func(a, b HostResponse) bool { return a.Bytes < b.Bytes },
+	"latency": func(a, b HostResponse) bool { return a.AvgLatencySeconds < b.AvgLatencySeconds },
+	"denials": func(a, b HostResponse) bool { return a.RobotsDenials < b.RobotsDenials },
+	"delay":   func(a, b HostResponse) bool { return a.DelaySeconds < b.DelaySeconds },
+	"backlog": func(a, b HostResponse) bool { return a.Backlog < b.Backlog },
+}
+
+// handleHosts lists every host seen so far, paginated like the other lists.
+// The sort parameter defaults to errors and the order parameter to desc, or
+// to asc when sorting by host.
+func (s *APIServer) handleHosts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	sortBy := strings.ToLower(query.Get("sort"))
+	if sortBy == "" {
+		sortBy = "errors"
+	}
+	less, ok := hostSorts[sortBy]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "sort must be one of host, pages, errors, bytes, latency, denials, delay or backlog, got "+sortBy)
+		return
+	}
+	order := strings.ToLower(query.Get("order"))
+	if order != "" && order != "asc" && order != "desc" {
+		writeError(w, http.StatusBadRequest, "order must be asc or desc, got "+order)
+		return
+	}
+	descending := order == "desc" || (order == "" && sortBy != "host")
+
+	page := 1
+	limit := 50
+	if p, err := strconv.Atoi(query.Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+
+	hosts := s.hosts()
+	sort.Slice(hosts, func(i, j int) bool {
+		a, b := hosts[i], hosts[j]
+		if descending {
+			a, b = b, a
+		}
+		if less(a, b) || less(b, a) {
+			return less(a, b)
+		}
+		return hosts[i].Host < hosts[j].Host
+	})
+
+	total := len(hosts)
+	start := (page - 1) * limit
+	end := start + limit
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HostsResponse{
+		Hosts:       append([]HostResponse{}, hosts[start:end]...),
+		TotalCount:  total,
+		CurrentPage: page,
+		TotalPages:  (total + limit - 1) / limit,
+	})
+}
+
+func (s *APIServer) handleHost(w http.ResponseWriter, r *http.Request) {
+	host := strings.ToLower(mux.Vars(r)["host"])
+	for _, response := range s.hosts() {
+		if response.Host == host {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "no stats for host "+host)
+}
+
+// hosts joins the per-host counters, throttling state and backlogs.
+func (s *APIServer) hosts() []HostResponse {
+	services := s.jobs.Services()
+	byHost := make(map[string]*HostResponse)
+	host := func(name string) *HostResponse {
+		response, exists := byHost[name]
+		if !exists {
+			response = &HostResponse{HostCounters: stats.HostCounters{Host: name, ErrorTypes: map[string]int{}}}
+			byHost[name] = response
+		}
+		return response
+	}
+
+	for _, counters := range services.Hosts.Hosts() {
+		host(counters.Host).HostCounters = counters
+	}
+	for name, rate := range services.Limiter.Rates() {
+		host(name).DelaySeconds = rate.Delay.Seconds()
+	}
+	for name, openUntil := range services.Breaker.OpenHosts() {
+		host(name).CircuitOpenUntil = &openUntil
+	}
+	for _, job := range s.jobs.List() {
+		for name, size := range job.Crawler.Run().Queue.HostSizes() {
+			host(name).Backlog += size
+		}
+	}
+
+	result := make([]HostResponse, 0, len(byHost))
+	for name, response := range byHost {
+		if name != "" {
+			result = append(result, *response)
+		}
+	}
+	return result
+}
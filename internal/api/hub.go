@@ -0,0 +1,345 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"webcrawler/internal/events"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket topics a client can subscribe to.
+const (
+	TopicStats  = "stats"  // Stats of the default job, every few seconds
+	TopicPages  = "pages"  // A page was crawled
+	TopicErrors = "errors" // A fetch failed
+	TopicEvents = "events" // Every crawl event passing the client's filter
+)
+
+var topics = map[string]bool{TopicStats: true, TopicPages: true, TopicErrors: true, TopicEvents: true}
+
+const (
+	writeWait      = 10 * time.Second  // Time allowed to write a message
+	pongWait       = 60 * time.Second  // Time allowed between pongs
+	pingPeriod     = pongWait * 9 / 10 // Must be shorter than pongWait
+	maxMessageSize = 4096              // Largest message read from a client
+	sendBuffer     = 256               // Messages queued per client
+	maxDropped     = sendBuffer        // Messages dropped in a row before a slow client is disconnected
+	closeTimeout   = 1 * time.Second   // Time allowed to write the close message
+)
+
+// Message is sent to subscribers of a topic.
+type Message struct {
+	Topic string      `json:"topic"`
+	Data  interface{} `json:"data"`
+}
+
+// ClientMessage changes a client's subscriptions, e.g.
+// {"action": "subscribe", "topics": ["pages"]}.
+type ClientMessage struct {
+	Action string   `json:"action"`
+	Topics []string `json:"topics"`
+}
+
+// SubscriptionsResponse confirms a client's subscriptions.
+type SubscriptionsResponse struct {
+	Subscriptions []string `json:"subscriptions"`
+}
+
+// Hub keeps the WebSocket clients and sends each published message to the
+// clients subscribed to its topic. Every client has its own writer, so a
+// slow client only holds up itself: its messages are dropped while its
+// buffer is full, and it is disconnected once it stays behind.
+type Hub struct {
+	mu      sync.Mutex
+	clients map[*client]struct{}
+	closed  bool
+	writers sync.WaitGroup
+}
+
+type client struct {
+	hub    *Hub
+	conn   *websocket.Conn
+	send   chan []byte
+	raw    bool // Sent the data of messages only, for /ws/stats and /ws/events
+	filter events.Filter
+
+	mu      sync.Mutex // Guards topics
+	topics  map[string]bool
+	dropped int // Messages dropped in a row, guarded by hub.mu
+
+	closeOnce sync.Once
+	closing   []byte        // Close message sent by the writer, nil if the connection failed
+	done      chan struct{} // Closed to stop the writer
+}
+
+func NewHub() *Hub {
+	return &Hub{clients: make(map[*client]struct{})}
+}
+
+// Serve registers the connection, subscribed to the topics, and reads its
+// messages until it is closed. Raw clients are sent the data of messages
+// only and can't change their subscriptions. Events are only sent if they
+// pass the filter. first, if not nil, is sent before any published message.
+func (h *Hub) Serve(conn *websocket.Conn, subscribed []string, raw bool, filter events.Filter, first interface{}) {
+	c := &client{
+		hub:    h,
+		conn:   conn,
+		send:   make(chan []byte, sendBuffer),
+		raw:    raw,
+		filter: filter,
+		topics: make(map[string]bool),
+		done:   make(chan struct{}),
+	}
+	for _, topic := range subscribed {
+		c.topics[topic] = true
+	}
+	if first != nil {
+		c.sendJSON(first)
+	}
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		c.close(websocket.CloseGoingAway, "server shutting down")
+		c.writeClose()
+		conn.Close()
+		return
+	}
+	h.clients[c] = struct{}{}
+	h.writers.Add(1)
+	h.mu.Unlock()
+
+	go c.writePump()
+	c.readPump()
+
+	h.mu.Lock()
+	delete(h.clients, c)
+	h.mu.Unlock()
+	c.fail()
+}
+
+// Publish sends data to the clients subscribed to the topic. It never
+// blocks. Messages are only encoded once a client wants them.
+func (h *Hub) Publish(topic string, data interface{}) {
+	event, isEvent := data.(events.Event)
+	var message, raw []byte
+	encode := func(cached *[]byte, v interface{}) []byte {
+		if *cached == nil {
+			var err error
+			if *cached, err = json.Marshal(v); err != nil {
+				fmt.Println("Error encoding WebSocket message:", err)
+			}
+		}
+		return *cached
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		if !c.subscribed(topic) || (isEvent && !c.filter.Match(event)) {
+			continue
+		}
+		var encoded []byte
+		if c.raw {
+			encoded = encode(&raw, data)
+		} else {
+			encoded = encode(&message, Message{Topic: topic, Data: data})
+		}
+		if encoded == nil {
+			return
+		}
+		h.enqueue(c, encoded)
+	}
+}
+
+// enqueue queues a message for the client, dropping it if the client's
+// buffer is full. The caller holds h.mu.
+func (h *Hub) enqueue(c *client, message []byte) {
+	select {
+	case c.send <- message:
+		c.dropped = 0
+	default:
+		c.dropped++
+		if c.dropped == maxDropped {
+			fmt.Printf("WebSocket client %s is too slow, disconnecting\n", c.conn.RemoteAddr())
+			c.close(websocket.CloseTryAgainLater, "client too slow")
+		}
+	}
+}
+
+// Close disconnects every client and rejects new ones. It returns once the
+// clients were sent a close message, or ctx is done.
+func (h *Hub) Close(ctx context.Context) error {
+	h.mu.Lock()
+	h.closed = true
+	for c := range h.clients {
+		c.close(websocket.CloseGoingAway, "server shutting down")
+	}
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.writers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close makes the writer send a close message and close the connection.
+func (c *client) close(code int, text string) {
+	c.closeOnce.Do(func() {
+		c.closing = websocket.FormatCloseMessage(code, text)
+		close(c.done)
+	})
+}
+
+// fail makes the writer close the connection without a close message.
+func (c *client) fail() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+func (c *client) subscribed(topic string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.topics[topic]
+}
+
+// subscriptions returns the client's topics in order.
+func (c *client) subscriptions() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		result = append(result, topic)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// sendJSON queues a reply to the client, dropping it if the buffer is full.
+func (c *client) sendJSON(v interface{}) {
+	message, err := json.Marshal(v)
+	if err != nil {
+		fmt.Println("Error encoding WebSocket message:", err)
+		return
+	}
+	select {
+	case c.send <- message:
+	default:
+	}
+}
+
+// readPump handles subscription changes and pongs until the connection
+// fails or the client goes away.
+func (c *client) readPump() {
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		if c.raw {
+			continue
+		}
+
+		var message ClientMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			c.sendJSON(ErrorResponse{Error: "invalid message: " + err.Error()})
+			continue
+		}
+		if err := c.handle(message); err != nil {
+			c.sendJSON(ErrorResponse{Error: err.Error()})
+			continue
+		}
+		c.sendJSON(SubscriptionsResponse{Subscriptions: c.subscriptions()})
+	}
+}
+
+// handle applies a subscription change.
+func (c *client) handle(message ClientMessage) error {
+	if message.Action != "subscribe" && message.Action != "unsubscribe" {
+		return fmt.Errorf("action must be subscribe or unsubscribe, got %q", message.Action)
+	}
+	if err := checkTopics(message.Topics); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, topic := range message.Topics {
+		if message.Action == "subscribe" {
+			c.topics[topic] = true
+		} else {
+			delete(c.topics, topic)
+		}
+	}
+	return nil
+}
+
+// writePump writes queued messages and pings. It is the only goroutine
+// writing to the connection, and closes it when done.
+func (c *client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+		c.hub.writers.Done()
+	}()
+
+	for {
+		select {
+		case message := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				c.fail()
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.fail()
+				return
+			}
+		case <-c.done:
+			c.writeClose()
+			return
+		}
+	}
+}
+
+// writeClose sends the close message, unless the connection failed.
+func (c *client) writeClose() {
+	if c.closing != nil {
+		c.conn.WriteControl(websocket.CloseMessage, c.closing, time.Now().Add(closeTimeout))
+	}
+}
+
+// checkTopics returns an error naming the first unknown topic.
+func checkTopics(list []string) error {
+	for _, topic := range list {
+		if !topics[topic] {
+			return fmt.Errorf("unknown topic %q, topics are %s, %s, %s and %s", topic, TopicStats, TopicPages, TopicErrors, TopicEvents)
+		}
+	}
+	return nil
+}
@@ -2,15 +2,25 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"webcrawler/internal/budget"
+	"webcrawler/internal/dedup"
+	"webcrawler/internal/events"
+	"webcrawler/internal/jobs"
+	"webcrawler/internal/metrics"
 	"webcrawler/internal/models"
-	"webcrawler/internal/queue"
+	"webcrawler/internal/retry"
+	"webcrawler/internal/robots"
 	"webcrawler/internal/stats"
 	"webcrawler/internal/storage"
 
@@ -19,22 +29,77 @@ import (
 )
 
 type APIServer struct {
-	storage       *storage.MongoDB
-	stats         *stats.CrawlerStats
-	crawledSet    *queue.CrawledSet
-	queue         *queue.Queue
-	upgrader      websocket.Upgrader
-	wsConnections map[*websocket.Conn]bool
+	storage  *storage.MongoDB
+	jobs     *jobs.Manager
+	robots   *robots.RobotsChecker
+	upgrader websocket.Upgrader
+	hub      *Hub
+
+	mu     sync.Mutex // Guards server and closed
+	server *http.Server
+	closed bool
+	done   chan struct{} // Closed on shutdown to end the event streams
 }
 
 type StatsResponse struct {
-	TotalCrawled    int     `json:"totalCrawled"`
-	TotalQueued     int     `json:"totalQueued"`
-	QueueSize       int     `json:"queueSize"`
-	CrawlRate       float64 `json:"crawlRate"`
-	CrawledToQueued float64 `json:"crawledToQueued"`
-	UptimeMinutes   float64 `json:"uptimeMinutes"`
-	Status          string  `json:"status"`
+	Job             string            `json:"job"`
+	TotalCrawled    int               `json:"totalCrawled"`
+	TotalQueued     int               `json:"totalQueued"`
+	QueueSize       int               `json:"queueSize"`
+	CrawlRate       float64           `json:"crawlRate"`
+	CrawledToQueued float64           `json:"crawledToQueued"`
+	UptimeMinutes   float64           `json:"uptimeMinutes"`
+	Status          string            `json:"status"`
+	Budget          budget.Report     `json:"budget"`
+	Robots          robots.CacheStats `json:"robots"`
+	Retries         retry.Counters    `json:"retries"`
+}
+
+// StatsHistoryResponse lists a job's stats samples, oldest first.
+type StatsHistoryResponse struct {
+	Job             string         `json:"job"`
+	IntervalSeconds float64        `json:"intervalSeconds"`
+	Samples         []stats.Sample `json:"samples"`
+}
+
+type RobotsGroupResponse struct {
+	Allow             []string `json:"allow"`
+	Disallow          []string `json:"disallow"`
+	CrawlDelaySeconds float64  `json:"crawlDelaySeconds,omitempty"`
+}
+
+type RobotsHostResponse struct {
+	Host              string                         `json:"host"`
+	Status            robots.FetchStatus             `json:"status"`
+	StatusCode        int                            `json:"statusCode,omitempty"`
+	Error             string                         `json:"error,omitempty"`
+	FetchedAt         time.Time                      `json:"fetchedAt"`
+	ExpiresAt         time.Time                      `json:"expiresAt"`
+	AppliedGroup      string                         `json:"appliedGroup,omitempty"`
+	CrawlDelaySeconds float64                        `json:"crawlDelaySeconds"`
+	Sitemaps          []string                       `json:"sitemaps"`
+	Groups            map[string]RobotsGroupResponse `json:"groups"`
+}
+
+type RobotsTestResponse struct {
+	URL               string             `json:"url"`
+	Allowed           bool               `json:"allowed"`
+	Reason            string             `json:"reason"`
+	Rule              string             `json:"rule,omitempty"`
+	Group             string             `json:"group,omitempty"`
+	CrawlDelaySeconds float64            `json:"crawlDelaySeconds"`
+	RobotsStatus      robots.FetchStatus `json:"robotsStatus,omitempty"`
+}
+
+type DuplicatesResponse struct {
+	Clusters    []dedup.Cluster `json:"clusters"`
+	TotalCount  int             `json:"totalCount"`
+	CurrentPage int             `json:"currentPage"`
+	TotalPages  int             `json:"totalPages"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
 }
 
 type SearchResponse struct {
@@ -44,27 +109,71 @@ type SearchResponse struct {
 	TotalPages  int           `json:"totalPages"`
 }
 
-func NewAPIServer(storage *storage.MongoDB, stats *stats.CrawlerStats, crawled *queue.CrawledSet, queue *queue.Queue) *APIServer {
-	return &APIServer{
-		storage:       storage,
-		stats:         stats,
-		crawledSet:    crawled,
-		queue:         queue,
-		upgrader:      websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }},
-		wsConnections: make(map[*websocket.Conn]bool),
+func NewAPIServer(storage *storage.MongoDB, jobManager *jobs.Manager) *APIServer {
+	s := &APIServer{
+		storage:  storage,
+		jobs:     jobManager,
+		robots:   jobManager.Services().Robots,
+		upgrader: websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }},
+		hub:      NewHub(),
+		done:     make(chan struct{}),
 	}
+
+	// Crawl events go to the subscribers of their topic, and all of them
+	// to the subscribers of events
+	jobManager.Services().Events.Subscribe(func(event events.Event) {
+		s.hub.Publish(TopicEvents, event)
+		switch event.Type {
+		case events.TypePage:
+			s.hub.Publish(TopicPages, event)
+		case events.TypeError:
+			s.hub.Publish(TopicErrors, event)
+		}
+	})
+	return s
 }
 
-func (s *APIServer) Start(port string) {
+// Start serves the API and dashboard until Shutdown is called. It returns
+// nil after a shutdown and the error otherwise.
+func (s *APIServer) Start(port string) error {
 	r := mux.NewRouter()
 
 	// API routes
 	r.HandleFunc("/api/stats", s.handleStats).Methods("GET")
+	r.HandleFunc("/api/stats/history", s.handleStatsHistory).Methods("GET")
 	r.HandleFunc("/api/search", s.handleSearch).Methods("GET")
 	r.HandleFunc("/api/pages", s.handlePages).Methods("GET")
+	r.HandleFunc("/api/duplicates", s.handleDuplicates).Methods("GET")
+	r.HandleFunc("/api/duplicates/{id}", s.handleDuplicateCluster).Methods("GET")
+	r.HandleFunc("/api/robots", s.handleRobots).Methods("GET")
+	r.HandleFunc("/api/robots/test", s.handleRobotsTest).Methods("GET")
+	r.HandleFunc("/api/hosts", s.handleHosts).Methods("GET")
+	r.HandleFunc("/api/hosts/{host}", s.handleHost).Methods("GET")
+	r.HandleFunc("/api/jobs", s.handleJobs).Methods("GET")
+	r.HandleFunc("/api/jobs", s.handleCreateJob).Methods("POST")
+
+	// Crawl control, for a named job or the default one
+	for _, prefix := range []string{"/api/jobs/{name}", "/api/crawl"} {
+		r.HandleFunc(prefix, s.handleCrawlStatus).Methods("GET")
+		r.HandleFunc(prefix+"/start", s.handleCrawlStart).Methods("POST")
+		r.HandleFunc(prefix+"/pause", s.handleCrawlPause).Methods("POST")
+		r.HandleFunc(prefix+"/resume", s.handleCrawlResume).Methods("POST")
+		r.HandleFunc(prefix+"/stop", s.handleCrawlStop).Methods("POST")
+		r.HandleFunc(prefix+"/seeds", s.handleCrawlSeeds).Methods("POST")
+	}
 
-	// WebSocket for live updates
-	r.HandleFunc("/ws/stats", s.handleWebSocket)
+	// Prometheus metrics
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	// WebSockets for live updates. /ws/stats sends bare stats for the
+	// dashboard, /ws/events bare crawl events, /ws messages of the
+	// subscribed topics
+	r.HandleFunc("/ws", s.handleWebSocket)
+	r.HandleFunc("/ws/stats", s.handleStatsWebSocket)
+	r.HandleFunc("/ws/events", s.handleEventsWebSocket)
+
+	// The crawl events as Server-Sent Events
+	r.HandleFunc("/api/events", s.handleEvents).Methods("GET")
 
 	// Static files - try multiple locations
 	staticPaths := []string{"./web/static/", "../web/static/", "../../web/static/"}
@@ -85,16 +194,82 @@ func (s *APIServer) Start(port string) {
 
 	fmt.Printf("API Server starting on port %s\n", port)
 	fmt.Printf("Static files serving from: %s\n", staticDir)
-	log.Fatal(http.ListenAndServe(":"+port, r))
+
+	server := &http.Server{Addr: ":" + port, Handler: r}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.server = server
+	s.mu.Unlock()
+
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown closes the WebSocket connections and event streams and stops the server once the
+// requests being handled are done, or ctx is.
+func (s *APIServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	server := s.server
+	if !s.closed {
+		close(s.done)
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	// Hijacked connections are not closed by the server's Shutdown
+	if err := s.hub.Close(ctx); err != nil {
+		fmt.Println("Error closing WebSocket connections:", err)
+	}
+
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
 }
 
 func (s *APIServer) handleStats(w http.ResponseWriter, r *http.Request) {
-	stats := s.getCurrentStats()
+	job, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+	stats := s.getCurrentStats(job)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
 }
 
+// handleStatsHistory returns the samples of the last range, such as 15m or
+// 6h, or all kept samples without one.
+func (s *APIServer) handleStatsHistory(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+
+	var since time.Time
+	if value := r.URL.Query().Get("range"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, "range must be a positive duration such as 15m or 6h, got "+value)
+			return
+		}
+		since = time.Now().Add(-d)
+	}
+
+	history := job.Crawler.Run().Stats
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(StatsHistoryResponse{
+		Job:             job.Name,
+		IntervalSeconds: history.Interval().Seconds(),
+		Samples:         history.History(since),
+	})
+}
+
 func (s *APIServer) handleSearch(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
 	pageStr := r.URL.Query().Get("page")
@@ -106,7 +281,7 @@ func (s *APIServer) handleSearch(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	results := s.searchPages(query, page, 10)
+	results := s.searchPages(r.Context(), s.namespace(r), query, page, 10)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(results)
@@ -131,62 +306,223 @@ func (s *APIServer) handlePages(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	results := s.getPages(page, limit)
+	results := s.getPages(r.Context(), s.namespace(r), page, limit)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(results)
 }
 
+func (s *APIServer) handleDuplicates(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+	pageStr := r.URL.Query().Get("page")
+	limitStr := r.URL.Query().Get("limit")
+
+	page := 1
+	limit := 10
+
+	if pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+
+	if limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+
+	// Single page clusters have no duplicates
+	clusters := job.Crawler.Run().Duplicates.Clusters(2)
+	total := len(clusters)
+	start := (page - 1) * limit
+	end := start + limit
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DuplicatesResponse{
+		Clusters:    append([]dedup.Cluster{}, clusters[start:end]...),
+		TotalCount:  total,
+		CurrentPage: page,
+		TotalPages:  (total + limit - 1) / limit,
+	})
+}
+
+func (s *APIServer) handleDuplicateCluster(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+	id := mux.Vars(r)["id"]
+
+	cluster, ok := job.Crawler.Run().Duplicates.Cluster(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no duplicate cluster "+id)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cluster)
+}
+
+func (s *APIServer) handleRobots(w http.ResponseWriter, r *http.Request) {
+	host := r.URL.Query().Get("host")
+	if host == "" {
+		writeError(w, http.StatusBadRequest, "missing host parameter")
+		return
+	}
+
+	info, ok := s.robots.HostInfo(host)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no robots.txt cached for "+host)
+		return
+	}
+
+	response := RobotsHostResponse{
+		Host:         info.Host,
+		Status:       info.Status,
+		StatusCode:   info.StatusCode,
+		Error:        info.Error,
+		FetchedAt:    info.FetchedAt,
+		ExpiresAt:    info.ExpiresAt,
+		AppliedGroup: info.AppliedGroup,
+		Sitemaps:     []string{},
+		Groups:       map[string]RobotsGroupResponse{},
+	}
+
+	if info.RobotsTxt != nil {
+		response.CrawlDelaySeconds = info.RobotsTxt.CrawlDelay.Seconds()
+		if len(info.RobotsTxt.SitemapURLs) > 0 {
+			response.Sitemaps = info.RobotsTxt.SitemapURLs
+		}
+		for group, rules := range info.RobotsTxt.UserAgentRules {
+			response.Groups[group] = RobotsGroupResponse{
+				Allow:             rules.Allow,
+				Disallow:          rules.Disallow,
+				CrawlDelaySeconds: rules.CrawlDelay.Seconds(),
+			}
+		}
+		if applied, ok := response.Groups[info.AppliedGroup]; ok && applied.CrawlDelaySeconds > 0 {
+			response.CrawlDelaySeconds = applied.CrawlDelaySeconds
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *APIServer) handleRobotsTest(w http.ResponseWriter, r *http.Request) {
+	targetURL := r.URL.Query().Get("url")
+	if targetURL == "" {
+		writeError(w, http.StatusBadRequest, "missing url parameter")
+		return
+	}
+	parsedURL, err := url.Parse(targetURL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Hostname() == "" {
+		writeError(w, http.StatusBadRequest, "url must be an absolute http or https URL")
+		return
+	}
+
+	decision := s.robots.Check(r.Context(), targetURL)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RobotsTestResponse{
+		URL:               decision.URL,
+		Allowed:           decision.Allowed,
+		Reason:            decision.Reason,
+		Rule:              decision.Rule,
+		Group:             decision.Group,
+		CrawlDelaySeconds: decision.CrawlDelay.Seconds(),
+		RobotsStatus:      decision.Status,
+	})
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
+}
+
+// handleWebSocket subscribes the client to the topics in the comma
+// separated topics parameter, stats by default. Clients change their
+// subscriptions by sending ClientMessages.
 func (s *APIServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	subscribed := []string{TopicStats}
+	if value := r.URL.Query().Get("topics"); value != "" {
+		subscribed = strings.Split(value, ",")
+		if err := checkTopics(subscribed); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("WebSocket upgrade error:", err)
 		return
 	}
-	defer conn.Close()
 
-	s.wsConnections[conn] = true
-	defer delete(s.wsConnections, conn)
-
-	// Send initial stats
-	stats := s.getCurrentStats()
-	conn.WriteJSON(stats)
-
-	// Keep connection alive
-	for {
-		_, _, err := conn.ReadMessage()
-		if err != nil {
-			break
+	var first interface{}
+	for _, topic := range subscribed {
+		if topic == TopicStats {
+			first = Message{Topic: TopicStats, Data: s.getCurrentStats(s.defaultJob())}
 		}
 	}
+	s.hub.Serve(conn, subscribed, false, events.Filter{}, first)
+}
+
+// handleStatsWebSocket sends the stats of the default job as they are
+// broadcast, starting with the current ones.
+func (s *APIServer) handleStatsWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("WebSocket upgrade error:", err)
+		return
+	}
+	s.hub.Serve(conn, []string{TopicStats}, true, events.Filter{}, s.getCurrentStats(s.defaultJob()))
 }
 
+// BroadcastStats sends the stats of the default job to their subscribers.
 func (s *APIServer) BroadcastStats() {
-	stats := s.getCurrentStats()
+	s.hub.Publish(TopicStats, s.getCurrentStats(s.defaultJob()))
+}
 
-	for conn := range s.wsConnections {
-		err := conn.WriteJSON(stats)
-		if err != nil {
-			conn.Close()
-			delete(s.wsConnections, conn)
-		}
+func (s *APIServer) getCurrentStats(job *jobs.Job) StatsResponse {
+	run := job.Crawler.Run()
+	info := s.jobs.Info(job)
+	uptime := time.Since(run.Stats.GetStartTime()).Minutes()
+	response := StatsResponse{
+		Job:           job.Name,
+		TotalCrawled:  run.Crawled.Size(),
+		TotalQueued:   run.Queue.TotalQueued(),
+		QueueSize:     run.Queue.Size(),
+		UptimeMinutes: uptime,
+		Status:        string(info.State),
+		Budget:        run.Budget.Report(),
+		Robots:        s.robots.CacheStats(),
+		Retries:       run.Retries.Counters(),
 	}
-}
 
-func (s *APIServer) getCurrentStats() StatsResponse {
-	return StatsResponse{
-		TotalCrawled:    s.crawledSet.Size(),
-		TotalQueued:     s.queue.TotalQueued(),
-		QueueSize:       s.queue.Size(),
-		CrawlRate:       float64(s.crawledSet.Size()) / time.Since(s.stats.GetStartTime()).Minutes(),
-		CrawledToQueued: float64(s.crawledSet.Size()) / float64(s.queue.TotalQueued()),
-		UptimeMinutes:   time.Since(s.stats.GetStartTime()).Minutes(),
-		Status:          "running",
+	// Rates stay 0 rather than NaN or Inf, which JSON can't encode
+	if uptime > 0 {
+		response.CrawlRate = float64(response.TotalCrawled) / uptime
+	}
+	if response.TotalQueued > 0 {
+		response.CrawledToQueued = float64(response.TotalCrawled) / float64(response.TotalQueued)
 	}
+	return response
 }
 
-func (s *APIServer) searchPages(query string, page, limit int) SearchResponse {
-	pages, total, err := s.storage.SearchPages(query, page, limit)
+func (s *APIServer) searchPages(ctx context.Context, db *storage.MongoDB, query string, page, limit int) SearchResponse {
+	pages, total, err := db.SearchPages(ctx, query, page, limit)
 	if err != nil {
 		log.Printf("Error searching pages: %v", err)
 		return SearchResponse{Pages: []models.Page{}, TotalCount: 0, CurrentPage: page, TotalPages: 0}
@@ -201,8 +537,8 @@ func (s *APIServer) searchPages(query string, page, limit int) SearchResponse {
 	}
 }
 
-func (s *APIServer) getPages(page, limit int) SearchResponse {
-	pages, total, err := s.storage.GetPages(page, limit)
+func (s *APIServer) getPages(ctx context.Context, db *storage.MongoDB, page, limit int) SearchResponse {
+	pages, total, err := db.GetPages(ctx, page, limit)
 	if err != nil {
 		log.Printf("Error getting pages: %v", err)
 		return SearchResponse{Pages: []models.Page{}, TotalCount: 0, CurrentPage: page, TotalPages: 0}
@@ -0,0 +1,220 @@
+package budget
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"webcrawler/internal/utils"
+)
+
+// Limits caps the resources a single crawl may use. A zero limit means unlimited.
+type Limits struct {
+	MaxPages         int           `json:"maxPages"`         // Pages fetched
+	MaxStoredPages   int           `json:"maxStoredPages"`   // Pages written to storage
+	MaxPagesPerHost  int           `json:"maxPagesPerHost"`  // Pages fetched from any single host
+	MaxBytes         int64         `json:"maxBytes"`         // Total bytes downloaded
+	MaxDuration      time.Duration `json:"maxDuration"`      // Wall-clock time since the crawl started
+	MaxDocumentBytes int           `json:"maxDocumentBytes"` // Size of a single document; larger ones are not parsed
+	MaxTokens        int           `json:"maxTokens"`        // HTML tokens read from a single document
+	MaxContentChars  int           `json:"maxContentChars"`  // Content characters kept from a single document
+}
+
+// DefaultLimits matches the limits the crawler has always used.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxPages:        5000,
+		MaxStoredPages:  1000,
+		MaxTokens:       25000,
+		MaxContentChars: 15000,
+	}
+}
+
+// Report is a snapshot of budget usage.
+type Report struct {
+	Pages           int     `json:"pages"`
+	StoredPages     int     `json:"storedPages"`
+	Bytes           int64   `json:"bytes"`
+	ElapsedMinutes  float64 `json:"elapsedMinutes"`
+	SkippedHostURLs int     `json:"skippedHostUrls"` // URLs dropped by the per-host limit
+	OversizedDocs   int     `json:"oversizedDocs"`
+	Exhausted       bool    `json:"exhausted"`
+	Reason          string  `json:"reason,omitempty"`
+	Limits          Limits  `json:"limits"`
+}
+
+// Budget tracks resource usage for one crawl against its limits.
+type Budget struct {
+	limits          Limits
+	startTime       time.Time
+	pages           int
+	storedPages     int
+	bytes           int64
+	perHost         map[string]int
+	skippedHostURLs int
+	oversizedDocs   int
+	reason          string
+	mu              sync.Mutex
+}
+
+func New(limits Limits) *Budget {
+	return &Budget{
+		limits:    limits,
+		startTime: time.Now(),
+		perHost:   make(map[string]int),
+	}
+}
+
+// Limits returns the configured limits.
+func (b *Budget) Limits() Limits {
+	return b.limits
+}
+
+// Exhausted reports whether a crawl-wide limit has been reached, and which one.
+func (b *Budget) Exhausted() (bool, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.reason == "" {
+		b.reason = b.checkLocked()
+	}
+	return b.reason != "", b.reason
+}
+
+func (b *Budget) checkLocked() string {
+	switch {
+	case b.limits.MaxPages > 0 && b.pages >= b.limits.MaxPages:
+		return fmt.Sprintf("page limit of %d reached", b.limits.MaxPages)
+	case b.limits.MaxBytes > 0 && b.bytes >= b.limits.MaxBytes:
+		return fmt.Sprintf("byte limit of %d reached", b.limits.MaxBytes)
+	case b.limits.MaxDuration > 0 && time.Since(b.startTime) >= b.limits.MaxDuration:
+		return fmt.Sprintf("time limit of %s reached", b.limits.MaxDuration)
+	}
+	return ""
+}
+
+// Deadline returns when the time limit runs out, if there is one.
+func (b *Budget) Deadline() (time.Time, bool) {
+	if b.limits.MaxDuration <= 0 {
+		return time.Time{}, false
+	}
+	return b.startTime.Add(b.limits.MaxDuration), true
+}
+
+// ReservePage claims one of the crawl's pages for a fetch about to start,
+// so concurrent fetches can't overrun the page limit, reporting false once
+// it is reached. A fetch that doesn't happen gives its page back with
+// ReleasePage.
+func (b *Budget) ReservePage() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.limits.MaxPages > 0 && b.pages >= b.limits.MaxPages {
+		return false
+	}
+	b.pages++
+	return true
+}
+
+// ReleasePage gives back a page claimed with ReservePage.
+func (b *Budget) ReleasePage() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pages > 0 {
+		b.pages--
+	}
+}
+
+// AllowHost reports whether the URL's host still has pages left in its budget.
+func (b *Budget) AllowHost(rawURL string) bool {
+	if b.limits.MaxPagesPerHost <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.perHost[utils.HostOf(rawURL)] >= b.limits.MaxPagesPerHost {
+		b.skippedHostURLs++
+		return false
+	}
+	return true
+}
+
+// ReserveHost claims a page of the URL's host budget for a fetch about to
+// start, so concurrent fetches can't overrun it, reporting false once the
+// host's limit is reached. A fetch that doesn't happen gives its page back
+// with ReleaseHost.
+func (b *Budget) ReserveHost(rawURL string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	host := utils.HostOf(rawURL)
+	if b.limits.MaxPagesPerHost > 0 && b.perHost[host] >= b.limits.MaxPagesPerHost {
+		b.skippedHostURLs++
+		return false
+	}
+	b.perHost[host]++
+	return true
+}
+
+// ReleaseHost gives back a page claimed with ReserveHost.
+func (b *Budget) ReleaseHost(rawURL string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if host := utils.HostOf(rawURL); b.perHost[host] > 0 {
+		b.perHost[host]--
+	}
+}
+
+// RecordFetch counts the size of a fetched page against the budget. The
+// page itself was claimed with ReservePage and ReserveHost.
+func (b *Budget) RecordFetch(size int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.bytes += int64(size)
+}
+
+// AllowDocument reports whether a document of the given size may be parsed.
+func (b *Budget) AllowDocument(size int) bool {
+	if b.limits.MaxDocumentBytes <= 0 || size <= b.limits.MaxDocumentBytes {
+		return true
+	}
+
+	b.mu.Lock()
+	b.oversizedDocs++
+	b.mu.Unlock()
+	return false
+}
+
+// ReserveStore claims a storage slot, reporting false once the limit is reached.
+func (b *Budget) ReserveStore() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.limits.MaxStoredPages > 0 && b.storedPages >= b.limits.MaxStoredPages {
+		return false
+	}
+	b.storedPages++
+	return true
+}
+
+func (b *Budget) Report() Report {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return Report{
+		Pages:           b.pages,
+		StoredPages:     b.storedPages,
+		Bytes:           b.bytes,
+		ElapsedMinutes:  time.Since(b.startTime).Minutes(),
+		SkippedHostURLs: b.skippedHostURLs,
+		OversizedDocs:   b.oversizedDocs,
+		Exhausted:       b.reason != "",
+		Reason:          b.reason,
+		Limits:          b.limits,
+	}
+}
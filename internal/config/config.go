@@ -2,47 +2,250 @@ package config
 
 import (
 	"fmt"
-	"os"
+	"strings"
+	"time"
+
+	"webcrawler/internal/budget"
+	"webcrawler/internal/dedup"
+	"webcrawler/internal/politeness"
+	"webcrawler/internal/recrawl"
+	"webcrawler/internal/retry"
+	"webcrawler/internal/robots"
+	"webcrawler/internal/scope"
+	"webcrawler/internal/seeds"
+	"webcrawler/internal/traps"
 
 	"github.com/joho/godotenv"
 )
 
+// Fetcher modes and storage backends.
+const (
+	FetcherChrome  = "chrome" // Render pages with headless Chrome
+	FetcherHTTP    = "http"   // Download pages with plain HTTP, without running scripts
+	StorageMongoDB = "mongodb"
+	StorageNone    = "none" // Crawl without storing pages
+)
+
 type Config struct {
-	DBAccess  bool
-	MongoURI  string
-	SeedURL   string
-	UserAgent string
+	DBAccess       bool
+	Storage        string
+	MongoURI       string
+	Seeds          []seeds.Seed // Seeds of the default job, normalized
+	UserAgent      string
+	Workers        int           // Pages each job fetches at once
+	Fetcher        string        // FetcherChrome or FetcherHTTP
+	FetchTimeout   time.Duration // Time limit of a single fetch
+	APIPort        int
+	MaxDepth       int
+	DomainMaxDepth map[string]int
+	Scope          scope.Config
+	Budget         budget.Limits
+	Traps          traps.Config
+	Sitemaps       bool
+	SitemapMaxURLs int
+	RobotsCacheTTL time.Duration
+	RobotsRetry    time.Duration
+	Retry          retry.Policy
+	Breaker        retry.BreakerConfig
+	Politeness     politeness.Config
+	ClearDB        bool
+	Recrawl        bool
+	RecrawlBatch   int
+	Revisit        recrawl.Config
+	Dedup          bool
+	DedupThreshold int
+	ExtractRules   string        // Path of a YAML or JSON file of extraction rules
+	ExitWhenDone   bool          // Exit once no job is active instead of serving the API for further crawls
+	MaxActiveJobs  int           // Crawl jobs running at once; others wait
+	Resume         bool          // Continue from the frontier saved when the last crawl was stopped
+	DrainTimeout   time.Duration // How long a shutdown waits for crawls to finish their pages before aborting them
+	StatsInterval  time.Duration // How often a stats sample is taken
+	StatsHistory   time.Duration // How long stats samples are kept
 }
 
-func Load() *Config {
-	dbAccess := true
-
-	// Try multiple locations for .env file
-	envPaths := []string{".env", "../.env", "../../.env"}
-	var envLoaded bool
-
-	for _, path := range envPaths {
+// Load reads the configuration from the command line arguments, env vars,
+// a .env file and the config file given by --config or CONFIG_FILE, in that
+// order of precedence. Every invalid setting is reported in the error.
+func Load(args []string) (*Config, error) {
+	// Try multiple locations for .env file. Its values don't replace env
+	// vars that are already set.
+	for _, path := range []string{".env", "../.env", "../../.env"} {
 		if godotenv.Load(path) == nil {
-			envLoaded = true
 			break
 		}
 	}
 
-	if !envLoaded {
-		fmt.Println("Error loading .env file")
-		dbAccess = false
+	l, err := newLoader(args)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{
+		Storage:        l.getString("STORAGE", StorageMongoDB),
+		MongoURI:       l.getString("MONGO_URI", ""),
+		Seeds:          loadSeeds(l),
+		UserAgent:      l.getString("USER_AGENT", ""),
+		Workers:        l.getInt("WORKERS", 1),
+		Fetcher:        l.getString("FETCHER", FetcherChrome),
+		FetchTimeout:   l.getDuration("FETCH_TIMEOUT", 30*time.Second),
+		APIPort:        l.getInt("API_PORT", 8080),
+		MaxDepth:       l.getInt("MAX_DEPTH", 0),
+		DomainMaxDepth: l.getDomainInts("MAX_DEPTH_PER_DOMAIN"),
+		Scope: scope.Config{
+			Mode:         scope.Mode(l.getString("SCOPE_MODE", "")),
+			AllowDomains: l.getList("SCOPE_ALLOW_DOMAINS"),
+			DenyDomains:  l.getList("SCOPE_DENY_DOMAINS"),
+			Include:      l.getFields("SCOPE_INCLUDE"),
+			Exclude:      l.getFields("SCOPE_EXCLUDE"),
+		},
+		Budget:         loadBudget(l),
+		Traps:          loadTraps(l),
+		Sitemaps:       l.getBool("SITEMAPS", true),
+		SitemapMaxURLs: l.getInt("SITEMAP_MAX_URLS", 10000),
+		RobotsCacheTTL: l.getDuration("ROBOTS_CACHE_TTL", robots.DefaultCacheTTL),
+		RobotsRetry:    l.getDuration("ROBOTS_RETRY_INTERVAL", robots.DefaultRetryInterval),
+		Retry:          loadRetry(l),
+		Breaker:        loadBreaker(l),
+		Politeness:     loadPoliteness(l),
+		ClearDB:        l.getBool("CLEAR_DB", true),
+		Recrawl:        l.getBool("RECRAWL", false),
+		RecrawlBatch:   l.getInt("RECRAWL_BATCH", 1000),
+		Revisit:        loadRevisit(l),
+		Dedup:          l.getBool("DEDUP", true),
+		DedupThreshold: l.getInt("DEDUP_THRESHOLD", dedup.DefaultThreshold),
+		ExtractRules:   l.getString("EXTRACT_RULES", ""),
+		ExitWhenDone:   l.getBool("EXIT_WHEN_DONE", false),
+		MaxActiveJobs:  l.getInt("MAX_ACTIVE_JOBS", 2),
+		Resume:         l.getBool("RESUME", false),
+		DrainTimeout:   l.getDuration("DRAIN_TIMEOUT", 30*time.Second),
+		StatsInterval:  l.getDuration("STATS_INTERVAL", time.Minute),
+		StatsHistory:   l.getDuration("STATS_HISTORY", 24*time.Hour),
+	}
+	cfg.DBAccess = cfg.Storage == StorageMongoDB
+
+	// Settings that could not be parsed kept their valid defaults, so
+	// validation doesn't report them twice
+	l.errs = append(l.errs, cfg.validate()...)
+	if len(l.errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n  %s", strings.Join(l.errs, "\n  "))
+	}
+	return cfg, nil
+}
+
+// validate returns a message for every setting out of range or missing.
+func (cfg *Config) validate() []string {
+	var errs []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(cfg.UserAgent != "", "USER_AGENT is required, e.g. --user-agent \"MyCrawler/1.0 (+https://example.com/bot)\"")
+	check(cfg.Storage == StorageMongoDB || cfg.Storage == StorageNone, "STORAGE must be %s or %s, got %q", StorageMongoDB, StorageNone, cfg.Storage)
+	check(cfg.Storage != StorageMongoDB || cfg.MongoURI != "", "MONGO_URI is required with STORAGE=%s; set STORAGE=%s to crawl without storing pages", StorageMongoDB, StorageNone)
+	check(cfg.Fetcher == FetcherChrome || cfg.Fetcher == FetcherHTTP, "FETCHER must be %s or %s, got %q", FetcherChrome, FetcherHTTP, cfg.Fetcher)
+	check(cfg.Workers >= 1, "WORKERS must be at least 1, got %d", cfg.Workers)
+	check(cfg.MaxActiveJobs >= 1, "MAX_ACTIVE_JOBS must be at least 1, got %d", cfg.MaxActiveJobs)
+	check(cfg.APIPort > 0 && cfg.APIPort <= 65535, "API_PORT must be between 1 and 65535, got %d", cfg.APIPort)
+	check(cfg.FetchTimeout > 0, "FETCH_TIMEOUT must be positive, got %s", cfg.FetchTimeout)
+	check(cfg.DrainTimeout > 0, "DRAIN_TIMEOUT must be positive, got %s", cfg.DrainTimeout)
+	check(cfg.StatsInterval > 0, "STATS_INTERVAL must be positive, got %s", cfg.StatsInterval)
+	check(cfg.StatsHistory >= cfg.StatsInterval, "STATS_HISTORY must be at least STATS_INTERVAL (%s), got %s", cfg.StatsInterval, cfg.StatsHistory)
+	check(cfg.MaxDepth >= 0, "MAX_DEPTH must not be negative, got %d", cfg.MaxDepth)
+	check(cfg.DedupThreshold >= 0 && cfg.DedupThreshold <= dedup.DefaultThreshold, "DEDUP_THRESHOLD must be between 0 and %d, got %d", dedup.DefaultThreshold, cfg.DedupThreshold)
+	check(cfg.Retry.MaxAttempts >= 1, "RETRY_MAX_ATTEMPTS must be at least 1, got %d", cfg.Retry.MaxAttempts)
+	check(cfg.Retry.MaxDelay >= 0, "RETRY_MAX_DELAY must not be negative, got %s", cfg.Retry.MaxDelay)
+
+	if _, err := scope.New(cfg.Scope, nil); err != nil {
+		errs = append(errs, "scope: "+err.Error())
+	}
+	return errs
+}
+
+// loadSeeds collects the seeds given as arguments, in SEED_URL, SEEDS and
+// the SEED_FILE, normalized and without duplicates.
+func loadSeeds(l *loader) []seeds.Seed {
+	urls := append([]string{}, l.args...)
+	if seedURL := l.getString("SEED_URL", ""); seedURL != "" {
+		urls = append(urls, seedURL)
 	}
+	list := seeds.FromURLs(append(urls, l.getList("SEEDS")...))
 
-	userAgent := os.Getenv("USER_AGENT")
-	if userAgent == "" {
-		fmt.Println("Error: USER_AGENT is not set")
-		os.Exit(1)
+	if path := l.getString("SEED_FILE", ""); path != "" {
+		fromFile, err := seeds.ReadFile(path)
+		if err != nil {
+			l.errorf("SEED_FILE: %v", err)
+		}
+		list = append(list, fromFile...)
 	}
 
-	return &Config{
-		DBAccess:  dbAccess,
-		MongoURI:  os.Getenv("MONGO_URI"),
-		SeedURL:   os.Getenv("SEED_URL"),
-		UserAgent: userAgent,
+	normalized, err := seeds.Normalize(list)
+	if err != nil {
+		l.errorf("seeds: %v", err)
 	}
+	return normalized
+}
+
+// loadBudget reads the crawl budget, keeping the defaults for unset settings.
+func loadBudget(l *loader) budget.Limits {
+	limits := budget.DefaultLimits()
+	limits.MaxPages = l.getInt("MAX_PAGES", limits.MaxPages)
+	limits.MaxStoredPages = l.getInt("MAX_STORED_PAGES", limits.MaxStoredPages)
+	limits.MaxPagesPerHost = l.getInt("MAX_PAGES_PER_HOST", limits.MaxPagesPerHost)
+	limits.MaxBytes = int64(l.getInt("MAX_BYTES", int(limits.MaxBytes)))
+	limits.MaxDuration = l.getDuration("MAX_CRAWL_DURATION", limits.MaxDuration)
+	limits.MaxDocumentBytes = l.getInt("MAX_DOCUMENT_BYTES", limits.MaxDocumentBytes)
+	limits.MaxTokens = l.getInt("MAX_TOKENS", limits.MaxTokens)
+	limits.MaxContentChars = l.getInt("MAX_CONTENT_CHARS", limits.MaxContentChars)
+	return limits
+}
+
+// loadTraps reads the trap detection thresholds, keeping the defaults for unset settings.
+func loadTraps(l *loader) traps.Config {
+	cfg := traps.DefaultConfig()
+	cfg.MaxURLLength = l.getInt("TRAP_MAX_URL_LENGTH", cfg.MaxURLLength)
+	cfg.MaxQueryParams = l.getInt("TRAP_MAX_QUERY_PARAMS", cfg.MaxQueryParams)
+	cfg.MaxRepeatedSegments = l.getInt("TRAP_MAX_REPEATED_SEGMENTS", cfg.MaxRepeatedSegments)
+	cfg.MaxPathDepth = l.getInt("TRAP_MAX_PATH_DEPTH", cfg.MaxPathDepth)
+	cfg.MaxPerPattern = l.getInt("TRAP_MAX_PER_PATTERN", cfg.MaxPerPattern)
+	cfg.RejectSessionIDs = l.getBool("TRAP_REJECT_SESSION_IDS", cfg.RejectSessionIDs)
+	return cfg
+}
+
+// loadRetry reads the fetch retry policy, keeping the defaults for unset settings.
+func loadRetry(l *loader) retry.Policy {
+	policy := retry.DefaultPolicy()
+	policy.MaxAttempts = l.getInt("RETRY_MAX_ATTEMPTS", policy.MaxAttempts)
+	policy.BaseDelay = l.getDuration("RETRY_BASE_DELAY", policy.BaseDelay)
+	policy.MaxDelay = l.getDuration("RETRY_MAX_DELAY", policy.MaxDelay)
+	return policy
+}
+
+// loadBreaker reads the per-host circuit breaker settings, keeping the defaults for unset settings.
+func loadBreaker(l *loader) retry.BreakerConfig {
+	cfg := retry.DefaultBreakerConfig()
+	cfg.FailureThreshold = l.getInt("BREAKER_FAILURE_THRESHOLD", cfg.FailureThreshold)
+	cfg.Cooldown = l.getDuration("BREAKER_COOLDOWN", cfg.Cooldown)
+	cfg.MaxCooldown = l.getDuration("BREAKER_MAX_COOLDOWN", cfg.MaxCooldown)
+	return cfg
+}
+
+// loadPoliteness reads the per-host rate limits, keeping the defaults for unset settings.
+func loadPoliteness(l *loader) politeness.Config {
+	cfg := politeness.DefaultConfig()
+	cfg.MinDelay = l.getDuration("HOST_MIN_DELAY", cfg.MinDelay)
+	cfg.MaxDelay = l.getDuration("HOST_MAX_DELAY", cfg.MaxDelay)
+	cfg.InitialDelay = l.getDuration("HOST_INITIAL_DELAY", cfg.InitialDelay)
+	cfg.TargetLatency = l.getDuration("HOST_TARGET_LATENCY", cfg.TargetLatency)
+	return cfg
+}
+
+// loadRevisit reads the revisit interval bounds, keeping the defaults for unset settings.
+func loadRevisit(l *loader) recrawl.Config {
+	cfg := recrawl.DefaultConfig()
+	cfg.DefaultInterval = l.getDuration("REVISIT_DEFAULT_INTERVAL", cfg.DefaultInterval)
+	cfg.MinInterval = l.getDuration("REVISIT_MIN_INTERVAL", cfg.MinInterval)
+	cfg.MaxInterval = l.getDuration("REVISIT_MAX_INTERVAL", cfg.MaxInterval)
+	return cfg
 }
@@ -0,0 +1,379 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// setting is a configuration key. Keys are named like their env var; in
+// config files they are lowercase and may be nested, so "scope: {mode: x}"
+// sets SCOPE_MODE, and on the command line they are flags like --scope-mode.
+type setting struct {
+	Key   string
+	Usage string
+}
+
+var settings = []setting{
+	{"SEED_URL", "URL the default job starts crawling from"},
+	{"SEEDS", "Comma separated URLs the default job starts crawling from"},
+	{"SEED_FILE", "File of seed URLs, one per line or CSV of url,depth,scope; - reads stdin"},
+	{"USER_AGENT", "User agent sent with every request (required)"},
+	{"WORKERS", "Pages each job fetches at once"},
+	{"FETCHER", "How pages are fetched: chrome renders them, http downloads them"},
+	{"FETCH_TIMEOUT", "Time limit of a single fetch"},
+	{"STORAGE", "Storage backend: mongodb, or none to crawl without storing pages"},
+	{"MONGO_URI", "MongoDB connection string, required with STORAGE=mongodb"},
+	{"CLEAR_DB", "Delete stored pages when starting"},
+	{"API_PORT", "Port of the API and web interface"},
+	{"MAX_DEPTH", "Link depth limit, 0 for none"},
+	{"MAX_DEPTH_PER_DOMAIN", "Depth limits per domain, e.g. example.com=3"},
+	{"SCOPE_MODE", "Hosts in scope: any, same-host, same-domain or list"},
+	{"SCOPE_ALLOW_DOMAINS", "Domains added to the scope"},
+	{"SCOPE_DENY_DOMAINS", "Domains never crawled"},
+	{"SCOPE_INCLUDE", "Path patterns a URL must match"},
+	{"SCOPE_EXCLUDE", "Path patterns of URLs to skip"},
+	{"MAX_PAGES", "Pages fetched per crawl, 0 for no limit"},
+	{"MAX_STORED_PAGES", "Pages stored per crawl, 0 for no limit"},
+	{"MAX_PAGES_PER_HOST", "Pages fetched per host, 0 for no limit"},
+	{"MAX_BYTES", "Bytes downloaded per crawl, 0 for no limit"},
+	{"MAX_CRAWL_DURATION", "Duration of a crawl, 0 for no limit"},
+	{"MAX_DOCUMENT_BYTES", "Largest document parsed"},
+	{"MAX_TOKENS", "HTML nodes parsed per page"},
+	{"MAX_CONTENT_CHARS", "Characters of text kept per page"},
+	{"TRAP_MAX_URL_LENGTH", "Longest URL queued"},
+	{"TRAP_MAX_QUERY_PARAMS", "Most query parameters in a queued URL"},
+	{"TRAP_MAX_REPEATED_SEGMENTS", "Most repetitions of a path segment"},
+	{"TRAP_MAX_PATH_DEPTH", "Most path segments in a queued URL"},
+	{"TRAP_MAX_PER_PATTERN", "URLs queued per URL pattern"},
+	{"TRAP_REJECT_SESSION_IDS", "Skip URLs with session IDs"},
+	{"SITEMAPS", "Seed the crawl from the seed hosts' sitemaps"},
+	{"SITEMAP_MAX_URLS", "URLs read from the sitemaps of a seed"},
+	{"ROBOTS_CACHE_TTL", "How long robots.txt is cached"},
+	{"ROBOTS_RETRY_INTERVAL", "When to refetch a robots.txt that failed"},
+	{"RETRY_MAX_ATTEMPTS", "Fetch attempts per URL"},
+	{"RETRY_BASE_DELAY", "Delay before the first retry"},
+	{"RETRY_MAX_DELAY", "Longest delay between retries, 0 for no limit"},
+	{"BREAKER_FAILURE_THRESHOLD", "Consecutive failures that pause a host"},
+	{"BREAKER_COOLDOWN", "First pause of a failing host"},
+	{"BREAKER_MAX_COOLDOWN", "Longest pause of a failing host"},
+	{"HOST_MIN_DELAY", "Shortest delay between requests to a host"},
+	{"HOST_MAX_DELAY", "Longest delay between requests to a host"},
+	{"HOST_INITIAL_DELAY", "Delay between requests to a new host"},
+	{"HOST_TARGET_LATENCY", "Response time above which a host is slowed down"},
+	{"RECRAWL", "Revisit stored pages that are due"},
+	{"RECRAWL_BATCH", "Stored pages revisited per crawl"},
+	{"REVISIT_DEFAULT_INTERVAL", "Revisit interval of a new page"},
+	{"REVISIT_MIN_INTERVAL", "Shortest revisit interval"},
+	{"REVISIT_MAX_INTERVAL", "Longest revisit interval"},
+	{"DEDUP", "Index only one page of each near-duplicate cluster"},
+	{"DEDUP_THRESHOLD", "Differing SimHash bits of near-duplicates, up to 3"},
+	{"EXTRACT_RULES", "YAML or JSON file of extraction rules"},
+	{"EXIT_WHEN_DONE", "Exit once no job is active"},
+	{"MAX_ACTIVE_JOBS", "Crawl jobs running at once"},
+	{"RESUME", "Continue from the frontier saved when the last crawl was stopped"},
+	{"DRAIN_TIMEOUT", "How long a shutdown waits for crawls to finish their pages"},
+	{"STATS_INTERVAL", "How often a stats sample is taken"},
+	{"STATS_HISTORY", "How long stats samples are kept"},
+}
+
+// boolSettings are switches. On the command line they are given as --dedup
+// or --dedup=false, like other boolean flags.
+var boolSettings = map[string]bool{
+	"CLEAR_DB":                true,
+	"TRAP_REJECT_SESSION_IDS": true,
+	"SITEMAPS":                true,
+	"RECRAWL":                 true,
+	"DEDUP":                   true,
+	"EXIT_WHEN_DONE":          true,
+	"RESUME":                  true,
+}
+
+// boolFlag is the flag of a switch. It keeps the value as given so it is
+// validated like the value of an env var.
+type boolFlag struct {
+	value string
+}
+
+func (f *boolFlag) String() string {
+	return f.value
+}
+
+func (f *boolFlag) Set(value string) error {
+	f.value = value
+	return nil
+}
+
+func (f *boolFlag) IsBoolFlag() bool {
+	return true
+}
+
+// loader reads settings from, in order of precedence, command line flags,
+// env vars, the config file and the defaults. Invalid values are collected
+// in errs so they can all be reported at once.
+type loader struct {
+	args     []string // Seed URLs given as arguments
+	flags    map[string]string
+	file     map[string]string
+	fileName string
+	errs     []string
+}
+
+// flagName returns the command line flag of a key, e.g. "max-depth".
+func flagName(key string) string {
+	return strings.ToLower(strings.ReplaceAll(key, "_", "-"))
+}
+
+// newLoader parses the command line flags and reads the config file named
+// by --config or CONFIG_FILE.
+func newLoader(args []string) (*loader, error) {
+	l := &loader{flags: make(map[string]string), file: make(map[string]string)}
+
+	fs := flag.NewFlagSet("crawler", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	configFile := fs.String("config", "", "YAML, JSON or TOML config file")
+	keys := make(map[string]string)
+	for _, s := range settings {
+		keys[flagName(s.Key)] = s.Key
+		if boolSettings[s.Key] {
+			fs.Var(&boolFlag{}, flagName(s.Key), s.Usage)
+		} else {
+			fs.String(flagName(s.Key), "", s.Usage)
+		}
+	}
+	fs.Usage = func() {
+		fs.SetOutput(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Usage: crawler [flags] [seed URL...]")
+		fmt.Fprintln(os.Stderr, "\nFlags override env vars, which override the config file.")
+		fs.PrintDefaults()
+	}
+
+	// Seed URLs may come before, between or after the flags
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		l.args = append(l.args, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if key, ok := keys[f.Name]; ok {
+			l.flags[key] = f.Value.String()
+		}
+	})
+
+	path := *configFile
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := l.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// readFile reads a YAML, JSON or TOML config file, chosen by its extension.
+func (l *loader) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	var values map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml", ".json":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return fmt.Errorf("config file %s: unsupported extension %q, use .yaml, .yml, .json or .toml", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	known := make(map[string]bool, len(settings))
+	for _, s := range settings {
+		known[s.Key] = true
+	}
+	if err := flatten("", values, known, l.file); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	l.fileName = path
+	return nil
+}
+
+// flatten turns nested file values into settings keyed like env vars.
+// Lists become one item per line and maps of a known key "key=value" pairs.
+func flatten(prefix string, values map[string]interface{}, known map[string]bool, out map[string]string) error {
+	for name, value := range values {
+		key := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+
+		nested, isMap := value.(map[string]interface{})
+		if !known[key] {
+			if !isMap {
+				return fmt.Errorf("unknown setting %q", strings.ToLower(key))
+			}
+			if err := flatten(key, nested, known, out); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			pairs := make([]string, 0, len(v))
+			for k, item := range v {
+				pairs = append(pairs, fmt.Sprintf("%s=%v", k, item))
+			}
+			sort.Strings(pairs)
+			out[key] = strings.Join(pairs, ",")
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			out[key] = strings.Join(items, "\n")
+		case nil:
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+// lookup returns a setting's value and where it came from. Empty env vars
+// count as unset.
+func (l *loader) lookup(key string) (string, string, bool) {
+	if value, ok := l.flags[key]; ok {
+		return value, "flag --" + flagName(key), true
+	}
+	if value := os.Getenv(key); value != "" {
+		return value, "env " + key, true
+	}
+	if value, ok := l.file[key]; ok {
+		return value, l.fileName, true
+	}
+	return "", "", false
+}
+
+func (l *loader) errorf(format string, args ...interface{}) {
+	l.errs = append(l.errs, fmt.Sprintf(format, args...))
+}
+
+// getString reads a string setting, falling back to def when unset.
+func (l *loader) getString(key, def string) string {
+	if value, _, ok := l.lookup(key); ok {
+		return strings.TrimSpace(value)
+	}
+	return def
+}
+
+// getInt reads an integer setting, falling back to def when unset.
+func (l *loader) getInt(key string, def int) int {
+	value, origin, ok := l.lookup(key)
+	if !ok {
+		return def
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		l.errorf("%s must be an integer, got %q (%s)", key, value, origin)
+		return def
+	}
+	return n
+}
+
+// getBool reads a boolean setting such as "true" or "0".
+func (l *loader) getBool(key string, def bool) bool {
+	value, origin, ok := l.lookup(key)
+	if !ok {
+		return def
+	}
+
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		l.errorf("%s must be true or false, got %q (%s)", key, value, origin)
+		return def
+	}
+	return b
+}
+
+// getDuration reads a duration setting such as "90s" or "2h".
+func (l *loader) getDuration(key string, def time.Duration) time.Duration {
+	value, origin, ok := l.lookup(key)
+	if !ok {
+		return def
+	}
+
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		l.errorf("%s must be a duration like 30s or 2h, got %q (%s)", key, value, origin)
+		return def
+	}
+	return d
+}
+
+// getList reads a comma or newline separated setting, dropping empty items.
+func (l *loader) getList(key string) []string {
+	value, _, _ := l.lookup(key)
+
+	var result []string
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getDomainInts reads a setting of the form "example.com=3,docs.example.org=5".
+func (l *loader) getDomainInts(key string) map[string]int {
+	result := make(map[string]int)
+	value, origin, _ := l.lookup(key)
+
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			l.errorf("invalid %s entry %q, expected domain=value (%s)", key, pair, origin)
+			continue
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			l.errorf("invalid %s value for %s: %q (%s)", key, parts[0], parts[1], origin)
+			continue
+		}
+		result[strings.ToLower(strings.TrimSpace(parts[0]))] = n
+	}
+
+	return result
+}
+
+// getFields reads a whitespace separated setting.
+func (l *loader) getFields(key string) []string {
+	value, _, _ := l.lookup(key)
+	return strings.Fields(value)
+}
@@ -0,0 +1,860 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"webcrawler/internal/budget"
+	"webcrawler/internal/config"
+	"webcrawler/internal/dedup"
+	"webcrawler/internal/documents"
+	"webcrawler/internal/events"
+	"webcrawler/internal/extract"
+	"webcrawler/internal/metrics"
+	"webcrawler/internal/models"
+	"webcrawler/internal/politeness"
+	"webcrawler/internal/queue"
+	"webcrawler/internal/retry"
+	"webcrawler/internal/robots"
+	"webcrawler/internal/scope"
+	"webcrawler/internal/seeds"
+	"webcrawler/internal/sitemap"
+	"webcrawler/internal/stats"
+	"webcrawler/internal/storage"
+	"webcrawler/internal/traps"
+)
+
+// State is the lifecycle state of the crawler.
+type State string
+
+const (
+	StateIdle     State = "idle"     // No crawl started yet
+	StateRunning  State = "running"  // Fetching pages
+	StatePaused   State = "paused"   // Waiting to be resumed
+	StateStopping State = "stopping" // Finishing the current page after a stop request
+	StateStopped  State = "stopped"  // Stopped before the frontier was done
+	StateFinished State = "finished" // Frontier empty or budget exhausted
+)
+
+var (
+	ErrActive     = errors.New("a crawl is already active")
+	ErrNotActive  = errors.New("no crawl is active")
+	ErrNotRunning = errors.New("crawl is not running")
+	ErrNotPaused  = errors.New("crawl is not paused")
+	ErrNoSeeds    = errors.New("no seed URLs given")
+)
+
+// Settings are the options of a single crawl. Fields left out of a start
+// request keep the configured defaults.
+type Settings struct {
+	Seeds    []seeds.Seed  `json:"seeds"`
+	MaxDepth int           `json:"maxDepth"`
+	Scope    scope.Config  `json:"scope"`
+	Budget   budget.Limits `json:"budget"`
+	Sitemaps bool          `json:"sitemaps"`
+	Recrawl  bool          `json:"recrawl"`
+	Resume   bool          `json:"resume"` // Continue from the frontier saved when the last crawl was stopped
+}
+
+// Run holds the frontier and counters of one crawl.
+type Run struct {
+	Settings   Settings
+	Queue      *queue.Queue
+	Crawled    *queue.CrawledSet
+	Budget     *budget.Budget
+	Scope      *scope.Scope
+	Traps      *traps.Detector
+	Duplicates *dedup.Index
+	Retries    *retry.Stats
+	Stats      *stats.CrawlerStats
+}
+
+// RecordStats takes a stats sample ending at t.
+func (run *Run) RecordStats(t time.Time) {
+	report := run.Budget.Report()
+	retries := run.Retries.Counters()
+	run.Stats.Update(t, stats.Totals{
+		Pages:     report.Pages,
+		Errors:    retries.Retries + retries.FailedURLs,
+		Bytes:     report.Bytes,
+		Crawled:   run.Crawled.Size(),
+		QueueSize: run.Queue.Size(),
+	})
+}
+
+// Status describes the crawler's state and its current or last crawl.
+type Status struct {
+	State      State     `json:"state"`
+	Reason     string    `json:"reason,omitempty"` // Why the last crawl ended
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Settings   Settings  `json:"settings"`
+}
+
+// Services are shared by every crawler of the process, so robots.txt,
+// politeness and circuit breaker state applies across jobs.
+type Services struct {
+	Fetcher   *Fetcher
+	Documents *documents.Registry
+	Pipeline  *extract.Pipeline
+	Robots    *robots.RobotsChecker
+	Breaker   *retry.Breaker
+	Limiter   *politeness.Limiter
+	Hosts     *stats.HostStats
+	Events    *events.Bus
+}
+
+func NewServices(cfg *config.Config, pipeline *extract.Pipeline) *Services {
+	fetcher := NewFetcher(cfg.UserAgent)
+	fetcher.SetTimeout(cfg.FetchTimeout)
+	fetcher.SetRender(cfg.Fetcher != config.FetcherHTTP)
+	documentRegistry := documents.DefaultRegistry()
+	fetcher.SetDocuments(documentRegistry, int64(cfg.Budget.MaxDocumentBytes))
+	robotsChecker := robots.NewRobotsChecker(fetcher)
+	robotsChecker.SetExpiry(cfg.RobotsCacheTTL, cfg.RobotsRetry)
+
+	return &Services{
+		Fetcher:   fetcher,
+		Documents: documentRegistry,
+		Pipeline:  pipeline,
+		Robots:    robotsChecker,
+		Breaker:   retry.NewBreaker(cfg.Breaker),
+		Limiter:   politeness.NewLimiter(cfg.Politeness),
+		Hosts:     stats.NewHostStats(),
+		Events:    events.NewBus(),
+	}
+}
+
+// Crawler runs one crawl at a time and can be started, paused, resumed and
+// stopped while the process keeps running.
+type Crawler struct {
+	cfg       *config.Config
+	db        *storage.MongoDB
+	fetcher   *Fetcher
+	documents *documents.Registry
+	pipeline  *extract.Pipeline
+	robots    *robots.RobotsChecker
+	breaker   *retry.Breaker
+	limiter   *politeness.Limiter
+	monitor   *Monitor
+
+	mu         sync.Mutex
+	state      State
+	reason     string
+	startedAt  time.Time
+	finishedAt time.Time
+	run        *Run
+	saveErr    error              // Why the last stopped crawl's frontier was not saved
+	cancel     context.CancelFunc // Stops the crawl
+	resume     chan struct{}      // Non-nil while paused, closed to resume
+	done       chan struct{}      // Closed when the crawl has ended
+}
+
+// New returns an idle crawler storing pages in db, which may be a job's
+// namespace.
+func New(cfg *config.Config, db *storage.MongoDB, services *Services) *Crawler {
+	c := &Crawler{
+		cfg:       cfg,
+		db:        db,
+		fetcher:   services.Fetcher,
+		documents: services.Documents,
+		pipeline:  services.Pipeline,
+		robots:    services.Robots,
+		breaker:   services.Breaker,
+		limiter:   services.Limiter,
+		monitor:   NewMonitor(db.Job(), services.Hosts, services.Events),
+		state:     StateIdle,
+		done:      make(chan struct{}),
+	}
+	close(c.done)
+
+	// An empty run keeps stats and lookups working before the first crawl
+	c.run, _ = c.newRun(Settings{Scope: cfg.Scope, Budget: cfg.Budget})
+	return c
+}
+
+// DefaultSettings returns the crawl settings from the configuration.
+func (c *Crawler) DefaultSettings() Settings {
+	settings := Settings{
+		MaxDepth: c.cfg.MaxDepth,
+		Scope:    c.cfg.Scope,
+		Budget:   c.cfg.Budget,
+		Sitemaps: c.cfg.Sitemaps,
+		Recrawl:  c.cfg.Recrawl,
+		Resume:   c.cfg.Resume,
+	}
+	settings.Seeds = append(settings.Seeds, c.cfg.Seeds...)
+	return settings
+}
+
+// Robots returns the robots.txt checker shared by all crawls.
+func (c *Crawler) Robots() *robots.RobotsChecker {
+	return c.robots
+}
+
+// SaveError returns why the frontier of the last stopped crawl could not be
+// saved, or nil.
+func (c *Crawler) SaveError() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.saveErr
+}
+
+// Run returns the current or last crawl.
+func (c *Crawler) Run() *Run {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.run
+}
+
+func (c *Crawler) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Status{
+		State:      c.state,
+		Reason:     c.reason,
+		StartedAt:  c.startedAt,
+		FinishedAt: c.finishedAt,
+		Settings:   c.run.Settings,
+	}
+}
+
+// Start begins a new crawl in the background. Fetches and writes use ctx,
+// so canceling it aborts them and ends the crawl at once.
+func (c *Crawler) Start(ctx context.Context, settings Settings) error {
+	if err := ValidateSettings(settings); err != nil {
+		return err
+	}
+	settings.Seeds, _ = seeds.Normalize(settings.Seeds)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.active() {
+		return ErrActive
+	}
+
+	run, err := c.newRun(settings)
+	if err != nil {
+		return err
+	}
+
+	c.run = run
+	c.state = StateRunning
+	c.reason = ""
+	c.saveErr = nil
+	c.startedAt = time.Now()
+	c.finishedAt = time.Time{}
+	stop, cancel := context.WithCancel(ctx)
+	c.cancel = cancel
+	c.resume = nil
+	c.done = make(chan struct{})
+
+	go func(done chan struct{}) {
+		defer cancel()
+		c.crawl(ctx, stop, run, done)
+	}(c.done)
+	return nil
+}
+
+// Pause holds the crawl after the page being fetched.
+func (c *Crawler) Pause() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state != StateRunning {
+		return ErrNotRunning
+	}
+	c.state = StatePaused
+	c.resume = make(chan struct{})
+	return nil
+}
+
+func (c *Crawler) Resume() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state != StatePaused {
+		return ErrNotPaused
+	}
+	c.state = StateRunning
+	close(c.resume)
+	c.resume = nil
+	return nil
+}
+
+// Stop ends the crawl once the page being fetched is done. Use Wait to
+// block until it has ended.
+func (c *Crawler) Stop() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state != StateRunning && c.state != StatePaused {
+		return ErrNotActive
+	}
+	c.state = StateStopping
+	c.cancel()
+	return nil
+}
+
+// Wait blocks until the current crawl has ended.
+func (c *Crawler) Wait() {
+	c.mu.Lock()
+	done := c.done
+	c.mu.Unlock()
+	<-done
+}
+
+// RejectedSeed is a seed URL that was not added, and why.
+type RejectedSeed struct {
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
+}
+
+// AddSeeds queues more seeds in the active crawl, extending its scope to
+// their hosts. It returns the normalized URLs of the seeds added.
+func (c *Crawler) AddSeeds(list []seeds.Seed) ([]string, []RejectedSeed, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.active() || c.state == StateStopping {
+		return nil, nil, ErrNotActive
+	}
+
+	var valid []seeds.Seed
+	var rejected []RejectedSeed
+	for _, seed := range list {
+		normalized, err := seeds.Check(seed)
+		if err != nil {
+			rejected = append(rejected, RejectedSeed{URL: seed.URL, Reason: err.Error()})
+			continue
+		}
+		valid = append(valid, normalized)
+	}
+
+	run := c.run
+	run.Scope.AddSeeds(seeds.URLs(valid))
+
+	var added []string
+	for _, seed := range valid {
+		if !run.Queue.Enqueue(seedEntry(seed), run.Crawled) {
+			rejected = append(rejected, RejectedSeed{URL: seed.URL, Reason: "already queued or crawled"})
+			continue
+		}
+		added = append(added, seed.URL)
+		run.Settings.Seeds = append(run.Settings.Seeds, seed)
+	}
+	return added, rejected, nil
+}
+
+// active reports whether a crawl is running, paused or stopping. The
+// caller holds c.mu.
+func (c *Crawler) active() bool {
+	return c.state == StateRunning || c.state == StatePaused || c.state == StateStopping
+}
+
+func (c *Crawler) newRun(settings Settings) (*Run, error) {
+	crawlScope, err := scope.New(settings.Scope, seeds.URLs(settings.Seeds))
+	if err != nil {
+		return nil, err
+	}
+
+	q := queue.NewQueue()
+	q.SetDepthLimits(queue.DepthLimits{
+		MaxDepth:  settings.MaxDepth,
+		PerDomain: c.cfg.DomainMaxDepth,
+	})
+
+	return &Run{
+		Settings:   settings,
+		Queue:      q,
+		Crawled:    queue.NewCrawledSet(),
+		Budget:     budget.New(settings.Budget),
+		Scope:      crawlScope,
+		Traps:      traps.NewDetector(c.cfg.Traps),
+		Duplicates: dedup.NewIndex(c.cfg.DedupThreshold),
+		Retries:    retry.NewStats(),
+		Stats:      stats.NewCrawlerStats(c.cfg.StatsInterval, c.cfg.StatsHistory),
+	}, nil
+}
+
+// ValidateSettings checks that a crawl has valid seeds and scope.
+func ValidateSettings(settings Settings) error {
+	if len(settings.Seeds) == 0 {
+		return ErrNoSeeds
+	}
+	normalized, err := seeds.Normalize(settings.Seeds)
+	if err != nil {
+		return err
+	}
+	_, err = scope.New(settings.Scope, seeds.URLs(normalized))
+	return err
+}
+
+// seedEntry returns the queue entry of a seed, carrying the seed's own
+// limits to the pages reached from it.
+func seedEntry(seed seeds.Seed) queue.Entry {
+	entry := queue.NewSeedEntry(seed.URL)
+	if seed.MaxDepth > 0 || seed.Scope != "" {
+		host := ""
+		if parsedURL, err := url.Parse(seed.URL); err == nil {
+			host = parsedURL.Hostname()
+		}
+		entry.Seed = &queue.SeedOptions{Host: host, MaxDepth: seed.MaxDepth, Scope: string(seed.Scope)}
+	}
+	return entry
+}
+
+// crawl seeds the frontier and fetches pages until it is empty, the budget
+// runs out or stop is done. A stopped crawl saves its frontier.
+func (c *Crawler) crawl(ctx, stop context.Context, run *Run, done chan struct{}) {
+	defer close(done)
+
+	q := run.Queue
+	restored := run.Settings.Resume && c.restoreFrontier(ctx, run)
+	if run.Settings.Recrawl {
+		duePages, err := c.db.GetPagesDue(ctx, time.Now(), c.cfg.RecrawlBatch)
+		if err != nil {
+			fmt.Println("Error loading pages to revisit:", err)
+		}
+		for _, page := range duePages {
+			q.Enqueue(queue.NewRevisitEntry(page), run.Crawled)
+		}
+		fmt.Printf("Revisiting %d stored pages\n", len(duePages))
+	}
+
+	for _, seed := range run.Settings.Seeds {
+		q.Enqueue(seedEntry(seed), run.Crawled)
+	}
+	if run.Settings.Sitemaps && !restored {
+		sitemapFetcher := sitemap.NewFetcher(c.fetcher, c.cfg.SitemapMaxURLs, 100)
+		// A site's sitemaps are walked once, however many seeds it has
+		walked := make(map[string]bool)
+		for _, seed := range run.Settings.Seeds {
+			parsedURL, err := url.Parse(seed.URL)
+			if err != nil {
+				continue
+			}
+			site := parsedURL.Scheme + "://" + parsedURL.Host
+			if walked[site] {
+				continue
+			}
+			walked[site] = true
+			SeedFromSitemaps(stop, seedEntry(seed), sitemapFetcher, q, run.Crawled, c.robots, run.Scope, run.Traps, c.monitor)
+		}
+	}
+
+	// The loop wakes up when the time budget runs out, even while it waits
+	// for the frontier
+	dispatch := stop
+	if deadline, ok := run.Budget.Deadline(); ok {
+		var cancel context.CancelFunc
+		dispatch, cancel = context.WithDeadline(stop, deadline)
+		defer cancel()
+	}
+
+	// Up to cfg.Workers pages are processed at once. busy holds a token per
+	// working worker, and idle is signaled whenever one is done.
+	busy := make(chan struct{}, c.cfg.Workers)
+	idle := make(chan struct{}, c.cfg.Workers)
+	var workers sync.WaitGroup
+	for {
+		if !c.waitWhilePaused(stop) {
+			workers.Wait()
+			reason := "stopped on request"
+			if err := c.saveFrontier(run); err != nil {
+				reason += ", frontier not saved"
+				c.mu.Lock()
+				c.saveErr = err
+				c.mu.Unlock()
+			}
+			c.finish(run, StateStopped, reason)
+			return
+		}
+		if exhausted, reason := run.Budget.Exhausted(); exhausted {
+			workers.Wait()
+			fmt.Printf("Crawl budget exhausted: %s\n", reason)
+			c.finish(run, StateFinished, "budget exhausted: "+reason)
+			return
+		}
+
+		// The frontier is only done once no worker can add links to it
+		if q.Size() == 0 {
+			if len(busy) == 0 {
+				if c.finishIfEmpty(run) {
+					return
+				}
+				continue
+			}
+			select {
+			case <-idle:
+			case <-dispatch.Done():
+			}
+			continue
+		}
+
+		select {
+		case busy <- struct{}{}:
+		case <-dispatch.Done():
+			continue
+		}
+		entry, err := q.Dequeue(dispatch)
+		if err != nil {
+			<-busy
+			continue // Stopped or out of time while waiting for a deferred entry
+		}
+
+		workers.Add(1)
+		go func() {
+			defer func() {
+				<-busy
+				workers.Done()
+				select {
+				case idle <- struct{}{}:
+				default:
+				}
+			}()
+			c.process(ctx, run, entry, make(chan FetchResult))
+		}()
+	}
+}
+
+// restoreFrontier queues the frontier saved by the job's last stopped
+// crawl and reports whether there was one. The saved copy is removed so it
+// is only resumed once.
+func (c *Crawler) restoreFrontier(ctx context.Context, run *Run) bool {
+	entries, crawled, err := c.db.LoadFrontier(ctx)
+	if err != nil {
+		fmt.Println("Error loading saved frontier:", err)
+		return false
+	}
+	if len(entries) == 0 {
+		return false
+	}
+
+	run.Queue.Restore(entries)
+	run.Crawled.AddHashes(crawled)
+	if err := c.db.DeleteFrontier(ctx); err != nil {
+		fmt.Println("Error deleting saved frontier:", err)
+	}
+	fmt.Printf("Resuming %d queued URLs, %d already crawled\n", len(entries), len(crawled))
+	return true
+}
+
+// saveFrontier stores the unfinished frontier so a later crawl can resume
+// it. It gets its own timeout since the crawl's context may be canceled.
+// Without storage there is nowhere to save it, which is not an error.
+func (c *Crawler) saveFrontier(run *Run) error {
+	entries := run.Queue.Entries()
+	if len(entries) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := c.db.SaveFrontier(ctx, entries, run.Crawled.Hashes())
+	if errors.Is(err, storage.ErrNotAccessible) {
+		fmt.Printf("Frontier of %d URLs not saved: %v\n", len(entries), err)
+		return nil
+	}
+	if err != nil {
+		fmt.Println("Error saving frontier:", err)
+		metrics.StorageError(metrics.OpSaveFrontier)
+		return err
+	}
+	fmt.Printf("Saved frontier of %d URLs\n", len(entries))
+	return nil
+}
+
+// waitWhilePaused blocks while the crawl is paused. It returns false once
+// the crawl has been stopped.
+func (c *Crawler) waitWhilePaused(stop context.Context) bool {
+	c.mu.Lock()
+	resume := c.resume
+	c.mu.Unlock()
+
+	if resume != nil {
+		select {
+		case <-resume:
+		case <-stop.Done():
+			return false
+		}
+	}
+
+	select {
+	case <-stop.Done():
+		return false
+	default:
+		return true
+	}
+}
+
+// finishIfEmpty ends the crawl if the frontier is empty. It holds the lock
+// so seeds added concurrently are not lost.
+func (c *Crawler) finishIfEmpty(run *Run) bool {
+	c.mu.Lock()
+	if run.Queue.Size() > 0 {
+		c.mu.Unlock()
+		return false
+	}
+	c.end(StateFinished, "frontier is empty")
+	c.mu.Unlock()
+
+	c.printReport(run)
+	return true
+}
+
+func (c *Crawler) finish(run *Run, state State, reason string) {
+	c.mu.Lock()
+	c.end(state, reason)
+	c.mu.Unlock()
+
+	c.printReport(run)
+}
+
+// end records how the crawl ended. The caller holds c.mu.
+func (c *Crawler) end(state State, reason string) {
+	c.state = state
+	c.reason = reason
+	c.finishedAt = time.Now()
+	c.resume = nil
+}
+
+// process fetches one URL from the frontier, parses it and stores the page.
+// If ctx is canceled meanwhile, the entry goes back to the frontier.
+func (c *Crawler) process(ctx context.Context, run *Run, entry queue.Entry, results chan FetchResult) {
+	cfg := c.cfg
+	q, crawled, crawlBudget := run.Queue, run.Crawled, run.Budget
+	url := entry.URL
+
+	// Drop URLs of hosts that used up their budget. A retried URL keeps the
+	// page it claimed on its first attempt.
+	if entry.Attempts == 0 && !crawlBudget.AllowHost(url) {
+		fmt.Printf("Host page budget used up, skipping %s\n", url)
+		c.monitor.BudgetSkipped(url)
+		return
+	}
+	if !entry.Marked {
+		crawled.Add(url)
+		entry.Marked = true
+	}
+
+	// Hold back hosts that keep failing
+	if openUntil := c.breaker.OpenUntil(url); !openUntil.IsZero() {
+		q.DeferHost(entry, openUntil)
+		return
+	}
+
+	// Check robots.txt before fetching
+	decision := c.robots.Check(ctx, url)
+	if ctx.Err() != nil {
+		q.Defer(entry, time.Now())
+		return
+	}
+	if !decision.Allowed {
+		reason := decision.Reason
+		if decision.Rule != "" {
+			reason += ": " + decision.Rule
+		}
+		fmt.Printf("Robots.txt disallows crawling: %s (%s)\n", url, reason)
+		c.monitor.RobotsDenied(url, decision.Rule)
+		return
+	}
+
+	// Respect the host's adaptive delay and crawl delay, crawling other
+	// hosts in the meantime
+	if wait := c.limiter.Reserve(url, decision.CrawlDelay); wait > 0 {
+		q.DeferHost(entry, time.Now().Add(wait))
+		return
+	}
+
+	// Claim a page of the crawl's and the host's budget, which fetches in
+	// flight count against. Past the crawl's page limit the entry stays in
+	// the frontier.
+	if !crawlBudget.ReservePage() {
+		q.Defer(entry, time.Now())
+		return
+	}
+	if entry.Attempts == 0 && !crawlBudget.ReserveHost(url) {
+		crawlBudget.ReleasePage()
+		fmt.Printf("Host page budget used up, skipping %s\n", url)
+		c.monitor.BudgetSkipped(url)
+		return
+	}
+
+	// Revisited pages are fetched conditionally
+	var validators Validators
+	if previous := entry.Previous; previous != nil {
+		validators = Validators{ETag: previous.ETag, LastModified: previous.LastModified}
+	}
+
+	entry.Attempts++
+	metrics.FetchStarted(url)
+	go c.fetcher.FetchPage(ctx, url, validators, results)
+	result := <-results
+	metrics.FetchDone(url)
+	content := result.Content
+
+	// An aborted fetch is not the host's fault, so it is not counted
+	if ctx.Err() != nil {
+		entry.Attempts--
+		crawlBudget.ReleasePage()
+		if entry.Attempts == 0 {
+			crawlBudget.ReleaseHost(url)
+		}
+		q.Defer(entry, time.Now())
+		return
+	}
+
+	// Unsupported documents are skipped before their body is downloaded
+	var unsupported *UnsupportedError
+	if errors.As(result.Err, &unsupported) {
+		fmt.Printf("Skipping %s: %v\n", url, unsupported)
+		if result.StatusCode != 0 {
+			c.monitor.Fetched(url, result, 0)
+			crawlBudget.RecordFetch(0)
+			c.limiter.Record(url, result.Latency, result.StatusCode, nil)
+		} else {
+			crawlBudget.ReleasePage()
+			crawlBudget.ReleaseHost(url)
+		}
+		return
+	}
+
+	c.monitor.Fetched(url, result, len(content))
+	crawlBudget.RecordFetch(len(content))
+	c.limiter.Record(url, result.Latency, result.StatusCode, result.Err)
+
+	// Skip revisited pages the server reports as unchanged
+	if result.NotModified && entry.Previous != nil {
+		fmt.Printf("Not modified: %s\n", url)
+		c.breaker.Success(url)
+		c.db.InsertPage(ctx, cfg.Revisit.NotModified(*entry.Previous, time.Now()))
+		return
+	}
+
+	if result.Err != nil {
+		transient, reason := retry.Classify(result.Err, result.StatusCode)
+		c.monitor.Failed(url, result, reason)
+		if transient && c.breaker.Failure(url) {
+			run.Retries.BreakerTrip()
+			fmt.Printf("Too many failures, pausing host of %s until %s\n", url, c.breaker.OpenUntil(url).Format(time.TimeOnly))
+		}
+
+		if cfg.Retry.ShouldRetry(entry.Attempts, transient) {
+			delay := cfg.Retry.Backoff(entry.Attempts, result.RetryAfter)
+			fmt.Printf("Retrying %s in %s after attempt %d (%s)\n", url, delay.Round(time.Second), entry.Attempts, reason)
+			run.Retries.Retry()
+			metrics.Retried()
+			q.Defer(entry, time.Now().Add(delay))
+			return
+		}
+
+		fmt.Printf("Giving up on %s after %d attempts (%s)\n", url, entry.Attempts, reason)
+		run.Retries.Failure(reason)
+		crawlBudget.ReleaseHost(url)
+		c.db.InsertFailure(ctx, models.FailedFetch{
+			Url:         url,
+			Attempts:    entry.Attempts,
+			Reason:      reason,
+			StatusCode:  result.StatusCode,
+			Error:       result.Err.Error(),
+			Depth:       entry.Depth,
+			ParentChain: entry.ParentChain,
+			FailedAt:    time.Now(),
+		})
+		return
+	}
+	c.breaker.Success(url)
+
+	if len(content) == 0 {
+		return
+	}
+	if !crawlBudget.AllowDocument(len(content)) {
+		fmt.Printf("Document too large (%d bytes), skipping: %s\n", len(content), url)
+		return
+	}
+
+	var page models.Page
+	var err error
+	if documents.IsHTML(result.ContentType) {
+		page, err = ParsePage(ctx, entry, content, c.pipeline, q, crawled, c.robots, run.Scope, crawlBudget, run.Traps, c.monitor)
+	} else {
+		page, err = ParseDocument(ctx, entry, result.ContentType, content, c.documents, q, crawled, c.robots, run.Scope, crawlBudget, run.Traps, c.monitor)
+	}
+	if ctx.Err() != nil {
+		entry.Attempts--
+		q.Defer(entry, time.Now())
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error extracting %s: %v\n", url, err)
+		return
+	}
+	c.monitor.Page(url, result, page.Title)
+	page.ETag = result.ETag
+	page.LastModified = result.LastModified
+	cfg.Revisit.Changed(&page, entry.Previous, time.Now())
+	if entry.Previous != nil && page.ContentHash == entry.Previous.ContentHash {
+		fmt.Printf("Unchanged: %s\n", url)
+	}
+
+	// Revisits always update their stored page
+	reserveStore := func() bool {
+		return entry.Previous != nil || crawlBudget.ReserveStore()
+	}
+
+	// Only the canonical page of a near-duplicate cluster is indexed, and a
+	// canonical page that can't be stored leaves the cluster as it was
+	if cfg.Dedup {
+		run.Duplicates.Add(page, func(cluster dedup.Result) bool {
+			page.ClusterID = cluster.ClusterID
+			if !cluster.Canonical {
+				fmt.Printf("Near-duplicate of %s, not indexing: %s\n", cluster.ClusterID, url)
+				if entry.Previous != nil {
+					c.db.DeletePage(ctx, url)
+				}
+				return true
+			}
+			if !reserveStore() {
+				return false
+			}
+			if cluster.Replaced != "" {
+				fmt.Printf("Replacing %s with %s as canonical page of %s\n", cluster.Replaced, url, cluster.ClusterID)
+				c.db.DeletePage(ctx, cluster.Replaced)
+			}
+			c.db.InsertPage(ctx, page)
+			return true
+		})
+		return
+	}
+
+	if reserveStore() {
+		c.db.InsertPage(ctx, page)
+	}
+}
+
+func (c *Crawler) printReport(run *Run) {
+	fmt.Println("\n------------------CRAWLER STATS------------------")
+	if job := c.db.Job(); job != "" {
+		fmt.Printf("Job: %s\n", job)
+	}
+	fmt.Printf("Total queued: %d\n", run.Queue.TotalQueued())
+	fmt.Printf("To be crawled (Queue) size: %d\n", run.Queue.Size())
+	fmt.Printf("Crawled size: %d\n", run.Crawled.Size())
+	report := run.Budget.Report()
+	fmt.Printf("Pages fetched: %d | Pages stored: %d | Bytes downloaded: %d\n", report.Pages, report.StoredPages, report.Bytes)
+	if report.Exhausted {
+		fmt.Printf("Stopped because the %s\n", report.Reason)
+	}
+	retryCounters := run.Retries.Counters()
+	fmt.Printf("Retries: %d | Failed URLs: %d\n", retryCounters.Retries, retryCounters.FailedURLs)
+	for reason, count := range run.Traps.Rejected() {
+		fmt.Printf("Rejected as possible trap (%s): %d\n", reason, count)
+	}
+	run.Stats.Print()
+}
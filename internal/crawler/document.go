@@ -0,0 +1,60 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"webcrawler/internal/budget"
+	"webcrawler/internal/dedup"
+	"webcrawler/internal/documents"
+	"webcrawler/internal/models"
+	"webcrawler/internal/queue"
+	"webcrawler/internal/robots"
+	"webcrawler/internal/scope"
+	"webcrawler/internal/traps"
+)
+
+// ParseDocument extracts a non-HTML document with the extractor registered
+// for its content type and enqueues the links it lists, such as feed
+// entries. Storing the returned page is left to the caller.
+func ParseDocument(ctx context.Context, entry queue.Entry, contentType string, content []byte, registry *documents.Registry, q *queue.Queue, crawled *queue.CrawledSet, robotsChecker *robots.RobotsChecker, crawlScope *scope.Scope, crawlBudget *budget.Budget, trapDetector *traps.Detector, monitor *Monitor) (models.Page, error) {
+	extractor, ok := registry.Lookup(contentType)
+	if !ok {
+		return models.Page{}, fmt.Errorf("%w: %s", documents.ErrUnsupported, contentType)
+	}
+
+	doc, err := extractor.Extract(entry.URL, content)
+	if err != nil {
+		return models.Page{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return models.Page{}, err
+	}
+	fmt.Printf("Count: %d | %s -> %s (%s)\n", crawled.Size(), entry.URL, doc.Title, doc.Type)
+
+	text := doc.Content
+	if limit := crawlBudget.Limits().MaxContentChars; limit > 0 && len(text) > limit {
+		text = strings.ToValidUTF8(text[:limit], "")
+	}
+
+	page := models.Page{
+		Url:           entry.URL,
+		Title:         doc.Title,
+		Content:       text,
+		DocType:       doc.Type,
+		Depth:         entry.Depth,
+		ParentChain:   entry.ParentChain,
+		DiscoveredAt:  entry.DiscoveredAt,
+		FetchAttempts: entry.Attempts,
+		ChangeFreq:    entry.ChangeFreq,
+	}
+	if fingerprint, ok := dedup.SimHash(page.Title + " " + page.Content); ok {
+		page.Fingerprint = dedup.FormatFingerprint(fingerprint)
+	}
+
+	for _, link := range doc.Links {
+		enqueueLink(ctx, entry, link, q, crawled, robotsChecker, crawlScope, trapDetector, monitor)
+	}
+	return page, nil
+}
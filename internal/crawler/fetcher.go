@@ -3,32 +3,345 @@ package crawler
 import (
 	"context"
 	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"webcrawler/internal/documents"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/chromedp"
 )
 
-func FetchPage(url string, c chan []byte) {
-	ctx, cancel := chromedp.NewContext(context.Background())
+// maxRedirects is how many redirects plain HTTP fetches follow before the
+// redirect response itself is returned. RFC 9309 asks for at least five.
+const maxRedirects = 5
+
+// Fetcher downloads pages with headless Chrome and other resources, such as
+// robots.txt, sitemaps and non-HTML documents, with plain HTTP. Both use the
+// same user agent.
+type Fetcher struct {
+	userAgent    string
+	client       *http.Client
+	documents    *documents.Registry
+	maxBodyBytes int64
+	timeout      time.Duration
+	render       bool // Render pages with headless Chrome rather than downloading them
+}
+
+func NewFetcher(userAgent string) *Fetcher {
+	return &Fetcher{
+		userAgent: userAgent,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > maxRedirects {
+					return http.ErrUseLastResponse
+				}
+				return nil
+			},
+		},
+		documents: documents.DefaultRegistry(),
+		timeout:   30 * time.Second,
+		render:    true,
+	}
+}
+
+// SetTimeout sets the time limit of a single fetch.
+func (f *Fetcher) SetTimeout(timeout time.Duration) {
+	f.timeout = timeout
+	f.client.Timeout = timeout
+}
+
+// SetRender sets whether pages are rendered with headless Chrome, which runs
+// their scripts, or downloaded with plain HTTP like documents.
+func (f *Fetcher) SetRender(render bool) {
+	f.render = render
+}
+
+// SetDocuments sets the extractors deciding which non-HTML documents are
+// downloaded, and the largest body read, 0 for no limit. Bodies of other
+// types, or announced as larger, are not downloaded.
+func (f *Fetcher) SetDocuments(registry *documents.Registry, maxBodyBytes int64) {
+	f.documents = registry
+	f.maxBodyBytes = maxBodyBytes
+}
+
+// UserAgent returns the user agent sent with every request.
+func (f *Fetcher) UserAgent() string {
+	return f.userAgent
+}
+
+// Get performs a plain HTTP GET with the crawler's user agent. Canceling
+// ctx aborts it.
+func (f *Fetcher) Get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.userAgent)
+	return f.client.Do(req)
+}
+
+// FetchResult is the outcome of a page fetch.
+type FetchResult struct {
+	Content      []byte
+	StatusCode   int           // 0 if no response was received
+	RetryAfter   time.Duration // From the Retry-After header, 0 if absent
+	ETag         string
+	LastModified string
+	ContentType  string // Media type of the response, such as "text/html"
+	NotModified  bool   // The server answered 304 to the validators sent
+	Latency      time.Duration
+	Err          error
+}
+
+// Validators are the ETag and Last-Modified of a previous fetch of a page.
+// Sent with the next fetch, they let the server answer 304 Not Modified
+// instead of sending the page again.
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+// each calls set with the name and value of every conditional request
+// header the validators make.
+func (v Validators) each(set func(name, value string)) {
+	if v.ETag != "" {
+		set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		set("If-Modified-Since", v.LastModified)
+	}
+}
+
+// StatusError is returned for responses with a 4xx or 5xx status.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// UnsupportedError is returned for documents no extractor handles. Their
+// bodies are not downloaded.
+type UnsupportedError struct {
+	ContentType string // Media type, or file extension when skipped unrequested
+	Size        int64  // Announced size when the document is too large, otherwise 0
+}
+
+func (e *UnsupportedError) Error() string {
+	if e.Size > 0 {
+		return fmt.Sprintf("document too large (%d bytes)", e.Size)
+	}
+	return fmt.Sprintf("unsupported content type %s", e.ContentType)
+}
+
+// FetchPage fetches a URL and sends the result on c. Web pages are rendered
+// with headless Chrome; URLs that look like documents are fetched with plain
+// HTTP, and those that look like unsupported files are not fetched at all.
+// The validators of a previous fetch, if any, make the request conditional.
+// Canceling ctx aborts the fetch.
+func (f *Fetcher) FetchPage(ctx context.Context, url string, validators Validators, c chan FetchResult) {
+	if parsedURL, err := neturl.Parse(url); err == nil {
+		skip, direct := documents.GuessFromPath(parsedURL.Path)
+		if skip {
+			c <- FetchResult{Err: &UnsupportedError{ContentType: strings.ToLower(path.Ext(parsedURL.Path))}}
+			return
+		}
+		if direct || !f.render {
+			c <- f.fetchDocument(ctx, url, validators)
+			return
+		}
+	}
+
+	opts := append(chromedp.DefaultExecAllocatorOptions[:], chromedp.UserAgent(f.userAgent))
+	allocCtx, cancel := chromedp.NewExecAllocator(ctx, opts...)
+	defer cancel()
+
+	ctx, cancel = chromedp.NewContext(allocCtx)
 	defer cancel()
 
-	ctx, cancel = context.WithTimeout(ctx, 30*time.Second)
+	ctx, cancel = context.WithTimeout(ctx, f.timeout)
 	defer cancel()
 
 	var content string
+	start := time.Now()
+
+	var err error
+	if validators != (Validators{}) {
+		err = revalidate(ctx, validators)
+	}
+	var resp *network.Response
+	if err == nil {
+		resp, err = chromedp.RunResponse(ctx, chromedp.Navigate(url))
+	}
+	result := FetchResult{Latency: time.Since(start)}
+
+	if resp != nil {
+		result.StatusCode = int(resp.Status)
+		result.ContentType = documents.MediaType(resp.MimeType)
+		for name, value := range resp.Headers {
+			switch strings.ToLower(name) {
+			case "retry-after":
+				result.RetryAfter = parseRetryAfter(fmt.Sprint(value))
+			case "etag":
+				result.ETag = fmt.Sprint(value)
+			case "last-modified":
+				result.LastModified = fmt.Sprint(value)
+			}
+		}
+	}
+
+	if err == nil && result.StatusCode == http.StatusNotModified {
+		result.NotModified = true
+		c <- result
+		return
+	}
+	if err == nil && result.StatusCode >= 400 {
+		err = &StatusError{StatusCode: result.StatusCode}
+	}
 
-	err := chromedp.Run(ctx,
-		chromedp.Navigate(url),
-		chromedp.WaitVisible(`body`, chromedp.ByQuery),
-		// chromedp.Sleep(1500*time.Millisecond), // Wait for hydration
-		chromedp.OuterHTML(`html`, &content, chromedp.ByQuery),
-	)
+	// Documents are downloaded again without the browser, which only
+	// renders web pages
+	if err == nil && !documents.IsHTML(result.ContentType) {
+		if _, ok := f.documents.Lookup(result.ContentType); !ok {
+			result.Err = &UnsupportedError{ContentType: result.ContentType}
+			c <- result
+			return
+		}
+		c <- f.fetchDocument(ctx, url, validators)
+		return
+	}
+
+	if err == nil {
+		err = chromedp.Run(ctx,
+			chromedp.WaitVisible(`body`, chromedp.ByQuery),
+			// chromedp.Sleep(1500*time.Millisecond), // Wait for hydration
+			chromedp.OuterHTML(`html`, &content, chromedp.ByQuery),
+		)
+	}
 
 	if err != nil {
-		fmt.Println("Error fetching page:", err)
-		c <- []byte("")
+		result.Err = err
+		c <- result
 		return
 	}
 
-	c <- []byte(content)
+	result.Content = []byte(content)
+	c <- result
+}
+
+// revalidate makes the browser send the validators with the first request
+// for a document, the navigation to the page, but not with the resources
+// the page loads.
+func revalidate(ctx context.Context, validators Validators) error {
+	var once sync.Once
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		paused, ok := ev.(*fetch.EventRequestPaused)
+		if !ok {
+			return
+		}
+		continueRequest := fetch.ContinueRequest(paused.RequestID)
+		once.Do(func() {
+			var headers []*fetch.HeaderEntry
+			for name, value := range paused.Request.Headers {
+				headers = append(headers, &fetch.HeaderEntry{Name: name, Value: fmt.Sprint(value)})
+			}
+			validators.each(func(name, value string) {
+				headers = append(headers, &fetch.HeaderEntry{Name: name, Value: value})
+			})
+			continueRequest = continueRequest.WithHeaders(headers)
+		})
+
+		// Listeners must not block, so the request is continued separately
+		go func() {
+			target := chromedp.FromContext(ctx).Target
+			continueRequest.Do(cdp.WithExecutor(ctx, target))
+		}()
+	})
+
+	patterns := []*fetch.RequestPattern{{URLPattern: "*", ResourceType: network.ResourceTypeDocument}}
+	return chromedp.Run(ctx, fetch.Enable().WithPatterns(patterns))
+}
+
+// fetchDocument downloads a document with plain HTTP. The body is only read
+// once the headers show an extractor handles it and it is not too large.
+func (f *Fetcher) fetchDocument(ctx context.Context, url string, validators Validators) FetchResult {
+	start := time.Now()
+	result := FetchResult{}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	req.Header.Set("User-Agent", f.userAgent)
+	validators.each(req.Header.Set)
+	resp, err := f.client.Do(req)
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	result.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	result.ETag = resp.Header.Get("ETag")
+	result.LastModified = resp.Header.Get("Last-Modified")
+	result.ContentType = documents.MediaType(resp.Header.Get("Content-Type"))
+
+	if resp.StatusCode == http.StatusNotModified {
+		result.NotModified = true
+		return result
+	}
+	if resp.StatusCode >= 400 {
+		result.Err = &StatusError{StatusCode: resp.StatusCode}
+		return result
+	}
+	if _, ok := f.documents.Lookup(result.ContentType); !ok && !documents.IsHTML(result.ContentType) {
+		result.Err = &UnsupportedError{ContentType: result.ContentType}
+		return result
+	}
+	if f.maxBodyBytes > 0 && resp.ContentLength > f.maxBodyBytes {
+		result.Err = &UnsupportedError{ContentType: result.ContentType, Size: resp.ContentLength}
+		return result
+	}
+
+	// Read one byte past the limit so oversized bodies are still recognised
+	body := io.Reader(resp.Body)
+	if f.maxBodyBytes > 0 {
+		body = io.LimitReader(resp.Body, f.maxBodyBytes+1)
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.Content = content
+	result.Latency = time.Since(start)
+	return result
+}
+
+// parseRetryAfter reads a Retry-After value given in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
 }
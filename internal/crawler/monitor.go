@@ -0,0 +1,84 @@
+package crawler
+
+import (
+	"webcrawler/internal/events"
+	"webcrawler/internal/metrics"
+	"webcrawler/internal/queue"
+	"webcrawler/internal/stats"
+)
+
+// Monitor records what happens to a job's URLs in the metrics, the per-host
+// stats and the live events.
+type Monitor struct {
+	job    string
+	hosts  *stats.HostStats
+	events *events.Bus
+}
+
+func NewMonitor(job string, hosts *stats.HostStats, bus *events.Bus) *Monitor {
+	return &Monitor{job: job, hosts: hosts, events: bus}
+}
+
+// Discovered records a URL added to the frontier.
+func (m *Monitor) Discovered(entry queue.Entry) {
+	m.events.Publish(events.Event{
+		Type:   events.TypeDiscovered,
+		Job:    m.job,
+		URL:    entry.URL,
+		Parent: entry.Parent,
+		Depth:  entry.Depth,
+	})
+}
+
+// RobotsDenied records a URL robots.txt disallows and the deciding rule,
+// if known.
+func (m *Monitor) RobotsDenied(url, rule string) {
+	metrics.RobotsDenied()
+	m.hosts.RobotsDenied(url)
+	m.events.Publish(events.Event{
+		Type:   events.TypeRobotsDenied,
+		Job:    m.job,
+		URL:    url,
+		Reason: rule,
+	})
+}
+
+// BudgetSkipped records a URL dropped because its host used up its page
+// budget.
+func (m *Monitor) BudgetSkipped(url string) {
+	metrics.BudgetSkipped()
+	m.hosts.BudgetSkipped(url)
+}
+
+// Fetched records a fetch that was not aborted. bytes is the size of the
+// body read, 0 if it was not downloaded.
+func (m *Monitor) Fetched(url string, result FetchResult, bytes int) {
+	metrics.Fetched(result.StatusCode, result.Latency, bytes)
+	m.hosts.Fetched(url, result.Latency, result.StatusCode, bytes)
+}
+
+// Failed records a failed fetch and its reason.
+func (m *Monitor) Failed(url string, result FetchResult, reason string) {
+	m.hosts.Failed(url, reason)
+	m.events.Publish(events.Event{
+		Type:           events.TypeError,
+		Job:            m.job,
+		URL:            url,
+		Status:         result.StatusCode,
+		LatencySeconds: result.Latency.Seconds(),
+		Error:          result.Err.Error(),
+		Reason:         reason,
+	})
+}
+
+// Page records a page that was fetched and parsed.
+func (m *Monitor) Page(url string, result FetchResult, title string) {
+	m.events.Publish(events.Event{
+		Type:           events.TypePage,
+		Job:            m.job,
+		URL:            url,
+		Status:         result.StatusCode,
+		Title:          title,
+		LatencySeconds: result.Latency.Seconds(),
+	})
+}
@@ -1,69 +1,91 @@
 package crawler
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"strings"
 
+	"webcrawler/internal/budget"
+	"webcrawler/internal/dedup"
+	"webcrawler/internal/documents"
+	"webcrawler/internal/extract"
 	"webcrawler/internal/models"
 	"webcrawler/internal/queue"
 	"webcrawler/internal/robots"
-	"webcrawler/internal/storage"
-	"webcrawler/internal/utils"
-
-	"golang.org/x/net/html"
+	"webcrawler/internal/scope"
+	"webcrawler/internal/traps"
 )
 
-func ParsePage(currUrl string, content []byte, q *queue.Queue, crawled *queue.CrawledSet, db *storage.MongoDB, robotsChecker *robots.RobotsChecker) {
-	z := html.NewTokenizer(bytes.NewReader(content))
-	tokenCount := 0
-	pageContentLength := 0
-	body := false
-	page := models.Page{Url: currUrl, Title: "", Content: ""}
+// ParsePage runs a fetched page through the extraction pipeline and
+// enqueues its links. Storing the returned page is left to the caller.
+func ParsePage(ctx context.Context, entry queue.Entry, content []byte, pipeline *extract.Pipeline, q *queue.Queue, crawled *queue.CrawledSet, robotsChecker *robots.RobotsChecker, crawlScope *scope.Scope, crawlBudget *budget.Budget, trapDetector *traps.Detector, monitor *Monitor) (models.Page, error) {
+	page := models.Page{
+		Url:           entry.URL,
+		DocType:       documents.TypeHTML,
+		Depth:         entry.Depth,
+		ParentChain:   entry.ParentChain,
+		DiscoveredAt:  entry.DiscoveredAt,
+		FetchAttempts: entry.Attempts,
+		ChangeFreq:    entry.ChangeFreq,
+	}
 
-	for {
-		if z.Next() == html.ErrorToken || tokenCount > 25000 {
-			if crawled.Size() < 1000 {
-				db.InsertPage(page)
-			}
-			return
-		}
-		t := z.Token()
-		if t.Type == html.StartTagToken {
-			if t.Data == "body" {
-				body = true
-			}
-			if t.Data == "javascript" || t.Data == "script" || t.Data == "style" {
-				z.Next()
-				continue
-			}
-			if t.Data == "title" {
-				z.Next()
-				title := z.Token().Data
-				page.Title = title
-				fmt.Printf("Count: %d | %s -> %s\n", crawled.Size(), currUrl, title)
-			}
-			if t.Data == "a" {
-				ok, href := utils.GetHref(t, currUrl)
-				if !ok {
-					continue
-				}
-				if crawled.Contains(href) {
-					continue
-				}
+	limits := crawlBudget.Limits()
+	links, err := pipeline.Run(ctx, entry.URL, content, &page, extract.Limits{MaxTokens: limits.MaxTokens, MaxContentChars: limits.MaxContentChars})
+	if err != nil {
+		return models.Page{}, err
+	}
+	fmt.Printf("Count: %d | %s -> %s\n", crawled.Size(), entry.URL, page.Title)
 
-				// Check robots.txt before adding to queue
-				if allowed, _ := robotsChecker.IsAllowed(href); allowed {
-					q.Enqueue(href, crawled)
-				} else {
-					fmt.Printf("Robots.txt disallows URL: %s\n", href)
-				}
-			}
-		}
-		if body && t.Type == html.TextToken && pageContentLength < 15000 {
-			page.Content += strings.TrimSpace(t.Data)
-			pageContentLength += len(t.Data)
+	for _, href := range links {
+		enqueueLink(ctx, entry, href, q, crawled, robotsChecker, crawlScope, trapDetector, monitor)
+	}
+
+	if fingerprint, ok := dedup.SimHash(page.Title + " " + page.Content); ok {
+		page.Fingerprint = dedup.FormatFingerprint(fingerprint)
+	}
+	return page, nil
+}
+
+// enqueueLink queues a link found on the entry's page if it is new, in
+// scope, not a likely trap and allowed by robots.txt.
+func enqueueLink(ctx context.Context, entry queue.Entry, href string, q *queue.Queue, crawled *queue.CrawledSet, robotsChecker *robots.RobotsChecker, crawlScope *scope.Scope, trapDetector *traps.Detector, monitor *Monitor) {
+	if crawled.Contains(href) {
+		return
+	}
+	if !inScope(entry, href, crawlScope) {
+		return
+	}
+	if ok, reason := trapDetector.Admit(href); !ok {
+		fmt.Printf("Possible crawler trap, skipping %s: %s\n", href, reason)
+		return
+	}
+
+	// Check robots.txt before adding to queue
+	decision := robotsChecker.Check(ctx, href)
+	if ctx.Err() != nil {
+		trapDetector.Release(href)
+		return
+	}
+	if decision.Allowed {
+		child := entry.Child(href)
+		if q.Enqueue(child, crawled) {
+			monitor.Discovered(child)
+		} else {
+			trapDetector.Release(href)
 		}
-		tokenCount++
+	} else {
+		trapDetector.Release(href)
+		fmt.Printf("Robots.txt disallows URL: %s\n", href)
+		monitor.RobotsDenied(href, decision.Rule)
+	}
+}
+
+// inScope checks a URL reached from the entry against the crawl's scope, or
+// the scope of the entry's seed if it has one of its own.
+func inScope(entry queue.Entry, href string, crawlScope *scope.Scope) bool {
+	if entry.Seed != nil && entry.Seed.Scope != "" {
+		allowed, _ := crawlScope.AllowsFrom(href, scope.Mode(entry.Seed.Scope), entry.Seed.Host)
+		return allowed
 	}
+	allowed, _ := crawlScope.Allows(href)
+	return allowed
 }
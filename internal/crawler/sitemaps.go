@@ -0,0 +1,72 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"webcrawler/internal/queue"
+	"webcrawler/internal/robots"
+	"webcrawler/internal/scope"
+	"webcrawler/internal/sitemap"
+	"webcrawler/internal/traps"
+)
+
+// SeedFromSitemaps enqueues the URLs listed in the seed host's sitemaps,
+// both those named in robots.txt and the conventional /sitemap.xml. The
+// sitemap hints become the entries' scheduling priority, and the seed's own
+// limits carry over. Canceling ctx stops the walk, keeping the URLs found so
+// far. It returns the number of URLs enqueued.
+func SeedFromSitemaps(ctx context.Context, seed queue.Entry, fetcher *sitemap.Fetcher, q *queue.Queue, crawled *queue.CrawledSet, robotsChecker *robots.RobotsChecker, crawlScope *scope.Scope, trapDetector *traps.Detector, monitor *Monitor) int {
+	seedURL := seed.URL
+	parsedURL, err := url.Parse(seedURL)
+	if err != nil {
+		return 0
+	}
+
+	sitemapURLs := robotsChecker.Sitemaps(ctx, seedURL)
+	defaultURL := parsedURL.Scheme + "://" + parsedURL.Host + "/sitemap.xml"
+	listed := false
+	for _, sitemapURL := range sitemapURLs {
+		if sitemapURL == defaultURL {
+			listed = true
+		}
+	}
+	if !listed {
+		sitemapURLs = append(sitemapURLs, defaultURL)
+	}
+
+	now := time.Now()
+	enqueued := 0
+	for _, u := range fetcher.Fetch(ctx, sitemapURLs) {
+		if !inScope(seed, u.Loc, crawlScope) {
+			continue
+		}
+		if ok, reason := trapDetector.Admit(u.Loc); !ok {
+			fmt.Printf("Possible crawler trap, skipping %s: %s\n", u.Loc, reason)
+			continue
+		}
+
+		entry := queue.Entry{
+			URL:          u.Loc,
+			Depth:        1,
+			Parent:       u.Sitemap,
+			ParentChain:  []string{u.Sitemap},
+			DiscoveredAt: now,
+			Priority:     u.Score(now),
+			LastMod:      u.LastMod,
+			ChangeFreq:   u.ChangeFreq,
+			Seed:         seed.Seed,
+		}
+		if q.Enqueue(entry, crawled) {
+			monitor.Discovered(entry)
+			enqueued++
+		} else {
+			trapDetector.Release(u.Loc)
+		}
+	}
+
+	fmt.Printf("Enqueued %d URLs from sitemaps of %s\n", enqueued, parsedURL.Host)
+	return enqueued
+}
@@ -0,0 +1,246 @@
+package dedup
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"webcrawler/internal/models"
+)
+
+// DefaultThreshold is the largest fingerprint distance treated as a duplicate.
+const DefaultThreshold = 3
+
+// bands splits a fingerprint into 16-bit pieces. Two fingerprints within
+// DefaultThreshold bits of each other share at least one piece exactly.
+const bands = 4
+
+// Member is a page in a duplicate cluster.
+type Member struct {
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	Fingerprint string    `json:"fingerprint"`
+	Distance    int       `json:"distance"` // Bits differing from the cluster's first page
+	AddedAt     time.Time `json:"addedAt"`
+}
+
+// Cluster groups near-duplicate pages under one canonical URL.
+type Cluster struct {
+	ID        string   `json:"id"`
+	Canonical string   `json:"canonical"`
+	Members   []Member `json:"members"`
+
+	fingerprint uint64
+	declared    string      // Member that declared itself canonical, if any
+	store       *sync.Mutex // Held while a page of the cluster is being stored
+}
+
+// Result tells the caller what to do with a page added to the index.
+type Result struct {
+	ClusterID string
+	Canonical bool   // The page is its cluster's representative and should be indexed
+	Replaced  string // Previous representative to remove from the index, if any
+}
+
+// Index clusters pages by SimHash at ingest.
+type Index struct {
+	threshold int
+	clusters  map[string]*Cluster
+	byURL     map[string]string     // URL to cluster ID
+	byBand    map[uint64][]*Cluster // Band key to clusters
+	nextID    int
+	mu        sync.Mutex
+}
+
+// NewIndex returns an empty index. Thresholds above DefaultThreshold may
+// miss some duplicates, since candidates are found by exact band matches.
+func NewIndex(threshold int) *Index {
+	return &Index{
+		threshold: threshold,
+		clusters:  make(map[string]*Cluster),
+		byURL:     make(map[string]string),
+		byBand:    make(map[uint64][]*Cluster),
+	}
+}
+
+// Add places the page in the cluster of its nearest duplicate, or a new
+// cluster if it has none, and picks the cluster's canonical URL. A page
+// declaring itself canonical wins; otherwise the shortest URL with the
+// fewest query parameters does. A page declaring another URL canonical is
+// not taken at its word, since only the canonical page is stored and the
+// other URL may never have been. Pages without a fingerprint are always
+// canonical.
+//
+// store applies the result to storage while the cluster is locked, so pages
+// of one cluster are stored one at a time. If it reports false the page was
+// not stored, and the cluster is left as it was before the page was added.
+func (idx *Index) Add(page models.Page, store func(Result) bool) Result {
+	fingerprint, ok := ParseFingerprint(page.Fingerprint)
+	if !ok {
+		result := Result{Canonical: true}
+		store(result)
+		return result
+	}
+	pageURL, declares := page.Url, page.CanonicalURL == page.Url
+
+	cluster, added := idx.join(page, fingerprint)
+	cluster.store.Lock()
+	defer cluster.store.Unlock()
+
+	idx.mu.Lock()
+	previous := cluster.Canonical
+	canonical, declared := previous, cluster.declared
+	switch {
+	case declares:
+		canonical, declared = pageURL, pageURL
+	case declared == "" && (previous == "" || canonicalRank(pageURL) < canonicalRank(previous)):
+		canonical = pageURL
+	}
+	idx.mu.Unlock()
+
+	result := Result{ClusterID: cluster.ID, Canonical: canonical == pageURL}
+	if result.Canonical && previous != "" && previous != pageURL {
+		result.Replaced = previous
+	}
+	stored := store(result)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if stored {
+		cluster.Canonical, cluster.declared = canonical, declared
+	} else if added {
+		idx.leave(cluster, pageURL)
+	}
+	return result
+}
+
+// join adds the page to its cluster, creating one if needed, and reports
+// whether it was not a member yet.
+func (idx *Index) join(page models.Page, fingerprint uint64) (*Cluster, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	cluster, exists := idx.clusters[idx.byURL[page.Url]]
+	if exists {
+		return cluster, false
+	}
+
+	cluster = idx.nearest(fingerprint)
+	if cluster == nil {
+		idx.nextID++
+		cluster = &Cluster{
+			ID:          fmt.Sprintf("c%d", idx.nextID),
+			fingerprint: fingerprint,
+			store:       &sync.Mutex{},
+		}
+		idx.clusters[cluster.ID] = cluster
+		for band := 0; band < bands; band++ {
+			key := bandKey(fingerprint, band)
+			idx.byBand[key] = append(idx.byBand[key], cluster)
+		}
+	}
+
+	cluster.Members = append(cluster.Members, Member{
+		URL:         page.Url,
+		Title:       page.Title,
+		Fingerprint: page.Fingerprint,
+		Distance:    Distance(cluster.fingerprint, fingerprint),
+		AddedAt:     time.Now(),
+	})
+	idx.byURL[page.Url] = cluster.ID
+	return cluster, true
+}
+
+// leave removes a page that joined the cluster but was not stored, and the
+// cluster itself once it has no members left.
+func (idx *Index) leave(cluster *Cluster, pageURL string) {
+	delete(idx.byURL, pageURL)
+	for i, member := range cluster.Members {
+		if member.URL == pageURL {
+			cluster.Members = append(cluster.Members[:i], cluster.Members[i+1:]...)
+			break
+		}
+	}
+	if len(cluster.Members) > 0 {
+		return
+	}
+
+	delete(idx.clusters, cluster.ID)
+	for band := 0; band < bands; band++ {
+		key := bandKey(cluster.fingerprint, band)
+		idx.byBand[key] = slices.DeleteFunc(idx.byBand[key], func(c *Cluster) bool { return c == cluster })
+	}
+}
+
+// nearest returns the closest cluster within the threshold, or nil.
+func (idx *Index) nearest(fingerprint uint64) *Cluster {
+	var best *Cluster
+	bestDistance := idx.threshold + 1
+	for band := 0; band < bands; band++ {
+		for _, candidate := range idx.byBand[bandKey(fingerprint, band)] {
+			if d := Distance(candidate.fingerprint, fingerprint); d < bestDistance {
+				best = candidate
+				bestDistance = d
+			}
+		}
+	}
+	return best
+}
+
+// Clusters returns the clusters with at least minSize members, largest first.
+func (idx *Index) Clusters(minSize int) []Cluster {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var result []Cluster
+	for _, cluster := range idx.clusters {
+		if len(cluster.Members) >= minSize {
+			result = append(result, copyCluster(cluster))
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if len(result[i].Members) != len(result[j].Members) {
+			return len(result[i].Members) > len(result[j].Members)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// Cluster returns one cluster by ID.
+func (idx *Index) Cluster(id string) (Cluster, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	cluster, exists := idx.clusters[id]
+	if !exists {
+		return Cluster{}, false
+	}
+	return copyCluster(cluster), true
+}
+
+func copyCluster(cluster *Cluster) Cluster {
+	c := *cluster
+	c.Members = append([]Member(nil), cluster.Members...)
+	return c
+}
+
+// canonicalRank orders candidate URLs: fewer query parameters first, then shorter.
+func canonicalRank(rawURL string) int {
+	params := 0
+	if parsedURL, err := url.Parse(rawURL); err == nil && parsedURL.RawQuery != "" {
+		params = strings.Count(parsedURL.RawQuery, "&") + 1
+	}
+	return params*10000 + len(rawURL)
+}
+
+func bandKey(fingerprint uint64, band int) uint64 {
+	bandBits := uint(64 / bands)
+	piece := (fingerprint >> (uint(band) * bandBits)) & (1<<bandBits - 1)
+	return uint64(band)<<bandBits | piece
+}
@@ -0,0 +1,66 @@
+package dedup
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// shingleSize is the number of consecutive words hashed together.
+const shingleSize = 3
+
+// MinWords is the fewest words a text needs for a meaningful fingerprint.
+// Shorter texts, such as empty or redirect pages, would all look alike.
+const MinWords = 20
+
+// SimHash returns a 64-bit fingerprint of the text in which similar texts
+// differ in few bits. It reports false when the text is too short.
+func SimHash(text string) (uint64, bool) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) < MinWords {
+		return 0, false
+	}
+
+	var weights [64]int
+	for i := 0; i+shingleSize <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+shingleSize], " ")))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var fingerprint uint64
+	for bit := 0; bit < 64; bit++ {
+		if weights[bit] > 0 {
+			fingerprint |= 1 << bit
+		}
+	}
+	return fingerprint, true
+}
+
+// Distance returns the number of differing bits between two fingerprints.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// FormatFingerprint encodes a fingerprint as 16 hex digits for storage.
+func FormatFingerprint(fingerprint uint64) string {
+	return fmt.Sprintf("%016x", fingerprint)
+}
+
+// ParseFingerprint decodes a fingerprint written by FormatFingerprint.
+func ParseFingerprint(s string) (uint64, bool) {
+	fingerprint, err := strconv.ParseUint(s, 16, 64)
+	return fingerprint, err == nil
+}
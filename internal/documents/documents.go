@@ -0,0 +1,110 @@
+package documents
+
+import (
+	"errors"
+	"mime"
+	"path"
+	"strings"
+)
+
+// Document types stored on pages.
+const (
+	TypeHTML = "html"
+	TypePDF  = "pdf"
+	TypeText = "text"
+	TypeFeed = "feed"
+)
+
+// ErrUnsupported is returned for content types no extractor handles.
+var ErrUnsupported = errors.New("unsupported content type")
+
+// Document is the text extracted from a non-HTML response.
+type Document struct {
+	Type    string
+	Title   string
+	Content string
+	Links   []string // URLs to enqueue, such as feed entries
+}
+
+// Extractor turns a response body into a Document.
+type Extractor interface {
+	Extract(url string, body []byte) (Document, error)
+}
+
+// Registry dispatches response bodies to extractors by media type. HTML is
+// not registered: it is rendered and parsed by the crawler itself.
+type Registry struct {
+	extractors map[string]Extractor
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		extractors: make(map[string]Extractor),
+	}
+}
+
+// DefaultRegistry handles PDF, plain text and RSS/Atom/RDF feeds.
+func DefaultRegistry() *Registry {
+	r := NewRegistry()
+	r.Register(PDFExtractor{}, "application/pdf")
+	r.Register(TextExtractor{}, "text/plain")
+	r.Register(FeedExtractor{}, "application/rss+xml", "application/atom+xml", "application/rdf+xml",
+		"application/xml", "text/xml")
+	return r
+}
+
+// Register makes the extractor handle the given media types, replacing any
+// extractor registered for them before.
+func (r *Registry) Register(extractor Extractor, mediaTypes ...string) {
+	for _, mediaType := range mediaTypes {
+		r.extractors[strings.ToLower(mediaType)] = extractor
+	}
+}
+
+// Lookup returns the extractor for a Content-Type header value.
+func (r *Registry) Lookup(contentType string) (Extractor, bool) {
+	extractor, ok := r.extractors[MediaType(contentType)]
+	return extractor, ok
+}
+
+// MediaType strips parameters such as charset from a Content-Type value.
+func MediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	}
+	return mediaType
+}
+
+// IsHTML reports whether a Content-Type is rendered as a web page. An empty
+// Content-Type counts as HTML, which is what most servers omit it for.
+func IsHTML(contentType string) bool {
+	switch MediaType(contentType) {
+	case "", "text/html", "application/xhtml+xml":
+		return true
+	}
+	return false
+}
+
+// skippedExtensions are never fetched: no extractor handles them and
+// downloading them would waste bandwidth.
+var skippedExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".svg": true, ".ico": true,
+	".mp3": true, ".mp4": true, ".avi": true, ".mov": true, ".webm": true, ".wav": true,
+	".zip": true, ".gz": true, ".tgz": true, ".rar": true, ".7z": true, ".tar": true,
+	".exe": true, ".dmg": true, ".msi": true, ".iso": true, ".apk": true,
+	".css": true, ".js": true, ".woff": true, ".woff2": true, ".ttf": true,
+	".doc": true, ".docx": true, ".xls": true, ".xlsx": true, ".ppt": true, ".pptx": true,
+}
+
+// directExtensions are fetched without a browser, since they are not web pages.
+var directExtensions = map[string]bool{
+	".pdf": true, ".txt": true, ".xml": true, ".rss": true, ".atom": true,
+}
+
+// GuessFromPath classifies a URL path by its extension: skip means it is a
+// known unsupported type, direct means it should be fetched without a browser.
+func GuessFromPath(urlPath string) (skip bool, direct bool) {
+	ext := strings.ToLower(path.Ext(urlPath))
+	return skippedExtensions[ext], directExtensions[ext]
+}
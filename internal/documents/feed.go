@@ -0,0 +1,118 @@
+package documents
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// FeedExtractor handles RSS 2.0, RSS 1.0 (RDF) and Atom feeds. The feed
+// title becomes the page title, entry titles and summaries its content, and
+// entry links are returned for crawling. Other XML is unsupported.
+type FeedExtractor struct{}
+
+type feed struct {
+	XMLName xml.Name
+	Title   string      `xml:"title"`   // Atom
+	Entries []feedEntry `xml:"entry"`   // Atom
+	Channel feedChannel `xml:"channel"` // RSS 2.0, RSS 1.0
+	Items   []feedEntry `xml:"item"`    // RSS 1.0 items sit outside the channel
+}
+
+type feedChannel struct {
+	Title string      `xml:"title"`
+	Items []feedEntry `xml:"item"`
+}
+
+type feedEntry struct {
+	Title       string     `xml:"title"`
+	Description string     `xml:"description"` // RSS
+	Summary     string     `xml:"summary"`     // Atom
+	Links       []feedLink `xml:"link"`
+}
+
+// feedLink holds an RSS link as text or an Atom link as attributes.
+type feedLink struct {
+	Text string `xml:",chardata"`
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+func (FeedExtractor) Extract(pageURL string, body []byte) (Document, error) {
+	var f feed
+	if err := xml.NewDecoder(bytes.NewReader(body)).Decode(&f); err != nil {
+		return Document{}, fmt.Errorf("invalid feed XML: %w", err)
+	}
+
+	var title string
+	var entries []feedEntry
+	switch f.XMLName.Local {
+	case "rss":
+		title, entries = f.Channel.Title, f.Channel.Items
+	case "RDF":
+		title, entries = f.Channel.Title, f.Items
+	case "feed":
+		title, entries = f.Title, f.Entries
+	default:
+		return Document{}, fmt.Errorf("%w: XML with root <%s>", ErrUnsupported, f.XMLName.Local)
+	}
+
+	base, _ := url.Parse(pageURL)
+	doc := Document{Type: TypeFeed, Title: strings.TrimSpace(title)}
+	var content []string
+
+	for _, entry := range entries {
+		content = append(content, strings.TrimSpace(entry.Title))
+		summary := entry.Description
+		if summary == "" {
+			summary = entry.Summary
+		}
+		if summary != "" {
+			content = append(content, stripTags(summary))
+		}
+
+		if link := entry.link(); link != "" && base != nil {
+			if ref, err := url.Parse(link); err == nil {
+				resolved := base.ResolveReference(ref)
+				if resolved.Scheme == "http" || resolved.Scheme == "https" {
+					doc.Links = append(doc.Links, resolved.String())
+				}
+			}
+		}
+	}
+
+	doc.Content = collapse(strings.Join(content, " "))
+	return doc, nil
+}
+
+// link returns the entry's RSS link or its Atom alternate link.
+func (e feedEntry) link() string {
+	for _, l := range e.Links {
+		if text := strings.TrimSpace(l.Text); text != "" {
+			return text
+		}
+		if l.Href != "" && (l.Rel == "" || l.Rel == "alternate") {
+			return strings.TrimSpace(l.Href)
+		}
+	}
+	return ""
+}
+
+// stripTags returns the text of an HTML fragment, as found in feed summaries.
+func stripTags(fragment string) string {
+	z := html.NewTokenizer(strings.NewReader(fragment))
+	var text strings.Builder
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return text.String()
+		case html.TextToken:
+			text.Write(z.Text())
+			text.WriteString(" ")
+		}
+	}
+}
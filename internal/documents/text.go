@@ -0,0 +1,88 @@
+package documents
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// maxTitleLength caps titles taken from the first line of a text.
+const maxTitleLength = 200
+
+var whitespace = regexp.MustCompile(`\s+`)
+
+// TextExtractor handles plain text. The first non-empty line is the title.
+type TextExtractor struct{}
+
+func (TextExtractor) Extract(url string, body []byte) (Document, error) {
+	if !utf8.Valid(body) {
+		body = bytes.ToValidUTF8(body, []byte("�"))
+	}
+	text := string(body)
+
+	return Document{
+		Type:    TypeText,
+		Title:   firstLine(text),
+		Content: collapse(text),
+	}, nil
+}
+
+// PDFExtractor pulls the plain text out of a PDF. The title comes from the
+// document info dictionary, falling back to the first line of text.
+type PDFExtractor struct{}
+
+func (PDFExtractor) Extract(url string, body []byte) (doc Document, err error) {
+	// The PDF library panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			doc, err = Document{}, fmt.Errorf("invalid PDF: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return Document{}, fmt.Errorf("invalid PDF: %w", err)
+	}
+
+	textReader, err := reader.GetPlainText()
+	if err != nil {
+		return Document{}, fmt.Errorf("extracting PDF text: %w", err)
+	}
+
+	var text strings.Builder
+	if _, err := io.Copy(&text, textReader); err != nil {
+		return Document{}, fmt.Errorf("extracting PDF text: %w", err)
+	}
+
+	title := strings.TrimSpace(reader.Trailer().Key("Info").Key("Title").Text())
+	if title == "" {
+		title = firstLine(text.String())
+	}
+
+	return Document{
+		Type:    TypePDF,
+		Title:   title,
+		Content: collapse(text.String()),
+	}, nil
+}
+
+func firstLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			if len(line) > maxTitleLength {
+				line = strings.ToValidUTF8(line[:maxTitleLength], "")
+			}
+			return line
+		}
+	}
+	return ""
+}
+
+func collapse(text string) string {
+	return strings.TrimSpace(whitespace.ReplaceAllString(text, " "))
+}
@@ -0,0 +1,129 @@
+// Package events carries live crawl events from the crawlers to the API's
+// subscribers.
+package events
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"webcrawler/internal/utils"
+)
+
+// Type is the kind of a crawl event.
+type Type string
+
+const (
+	TypePage         Type = "page"          // A page was fetched and parsed
+	TypeDiscovered   Type = "discovered"    // A new URL was queued
+	TypeRobotsDenied Type = "robots-denied" // robots.txt disallows a URL
+	TypeError        Type = "error"         // A fetch failed
+)
+
+// Types lists the event types.
+var Types = []Type{TypePage, TypeDiscovered, TypeRobotsDenied, TypeError}
+
+// Event describes something that happened during a crawl.
+type Event struct {
+	Type           Type      `json:"type"`
+	Time           time.Time `json:"time"`
+	Job            string    `json:"job,omitempty"`
+	URL            string    `json:"url"`
+	Host           string    `json:"host"`
+	Status         int       `json:"status,omitempty"` // HTTP status, 0 if no response was received
+	Title          string    `json:"title,omitempty"`
+	LatencySeconds float64   `json:"latencySeconds,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	Reason         string    `json:"reason,omitempty"` // Failure class, such as "timeout" or "http 503", or the deciding robots.txt rule
+	Parent         string    `json:"parent,omitempty"` // Page or sitemap a discovered URL was found on
+	Depth          int       `json:"depth,omitempty"`
+}
+
+// Filter selects events by type, host and job. Empty lists match
+// everything.
+type Filter struct {
+	Types []Type
+	Hosts []string // Hosts and their subdomains
+	Jobs  []string
+}
+
+// NewFilter returns a filter from lists of names, checking the types.
+func NewFilter(types, hosts, jobs []string) (Filter, error) {
+	filter := Filter{Jobs: jobs}
+	for _, name := range types {
+		if !slices.Contains(Types, Type(name)) {
+			return Filter{}, fmt.Errorf("unknown event type %q, types are %s, %s, %s and %s", name, TypePage, TypeDiscovered, TypeRobotsDenied, TypeError)
+		}
+		filter.Types = append(filter.Types, Type(name))
+	}
+	for _, host := range hosts {
+		filter.Hosts = append(filter.Hosts, strings.TrimPrefix(strings.ToLower(host), "."))
+	}
+	return filter, nil
+}
+
+// Match reports whether the event passes the filter.
+func (f Filter) Match(event Event) bool {
+	if len(f.Types) > 0 && !slices.Contains(f.Types, event.Type) {
+		return false
+	}
+	if len(f.Jobs) > 0 && !slices.Contains(f.Jobs, event.Job) {
+		return false
+	}
+	if len(f.Hosts) == 0 {
+		return true
+	}
+	for _, host := range f.Hosts {
+		if event.Host == host || strings.HasSuffix(event.Host, "."+host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Bus passes every published event to the subscribers. Subscribers are
+// called on the publishing goroutine, so they must not block.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[int]func(Event)
+	next        int
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[int]func(Event))}
+}
+
+// Subscribe calls fn for every event published until the returned function
+// is called.
+func (b *Bus) Subscribe(fn func(Event)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.next
+	b.next++
+	b.subscribers[id] = fn
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, id)
+	}
+}
+
+// Publish sends the event to the subscribers, setting its time and host
+// if unset.
+func (b *Bus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.Host == "" {
+		event.Host = utils.HostOf(event.URL)
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, fn := range b.subscribers {
+		fn(event)
+	}
+}
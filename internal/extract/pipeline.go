@@ -0,0 +1,152 @@
+package extract
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"webcrawler/internal/models"
+
+	"golang.org/x/net/html"
+)
+
+// Document is a parsed HTML page passed through the pipeline. Stages read
+// the node tree and fill in the page and the discovered links.
+type Document struct {
+	URL   string
+	Root  *html.Node
+	Page  *models.Page
+	Links []string // Absolute URLs to enqueue, in document order
+
+	limits Limits
+}
+
+// Limits bounds the work done on a single page. A zero limit means unlimited.
+type Limits struct {
+	MaxTokens       int // HTML tokens parsed; the rest of the page is dropped
+	MaxContentChars int // Content characters kept
+}
+
+// Walk visits the nodes of the document depth-first in document order. The
+// visit function returns false to skip a node's children.
+func (d *Document) Walk(visit func(n *html.Node) bool) {
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if !visit(n) {
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(d.Root)
+}
+
+// Limits returns the limits of the run the document belongs to.
+func (d *Document) Limits() Limits {
+	return d.limits
+}
+
+// SetField stores a site-specific value on the page.
+func (d *Document) SetField(name string, value interface{}) {
+	if d.Page.Fields == nil {
+		d.Page.Fields = make(map[string]interface{})
+	}
+	d.Page.Fields[name] = value
+}
+
+// Stage is one step of the extraction pipeline.
+type Stage interface {
+	Name() string
+	Extract(doc *Document) error
+}
+
+// StageFunc adapts a function to a Stage.
+type StageFunc struct {
+	StageName string
+	Func      func(doc *Document) error
+}
+
+func (s StageFunc) Name() string {
+	return s.StageName
+}
+
+func (s StageFunc) Extract(doc *Document) error {
+	return s.Func(doc)
+}
+
+// Pipeline runs the stages over each HTML page in order: link extraction,
+// metadata and content first, then any registered custom stages.
+type Pipeline struct {
+	stages []Stage
+}
+
+// NewPipeline returns a pipeline with the given stages.
+func NewPipeline(stages ...Stage) *Pipeline {
+	return &Pipeline{stages: stages}
+}
+
+// DefaultPipeline returns a pipeline with the built-in link, metadata and
+// content stages.
+func DefaultPipeline() *Pipeline {
+	return NewPipeline(LinkStage{}, MetadataStage{}, ContentStage{})
+}
+
+// Register appends a custom stage, run after the built-in ones.
+func (p *Pipeline) Register(stage Stage) {
+	p.stages = append(p.stages, stage)
+}
+
+// Stages returns the names of the stages in the order they run.
+func (p *Pipeline) Stages() []string {
+	names := make([]string, len(p.stages))
+	for i, stage := range p.stages {
+		names[i] = stage.Name()
+	}
+	return names
+}
+
+// Run parses the content within the limits of the crawl and runs every
+// stage on it, filling in the page. A failing stage is logged and skipped so
+// the others still run, while a canceled ctx ends the run between stages. It
+// returns the links found on the page.
+func (p *Pipeline) Run(ctx context.Context, pageURL string, content []byte, page *models.Page, limits Limits) ([]string, error) {
+	root, err := html.Parse(bytes.NewReader(truncate(content, limits.MaxTokens)))
+	if err != nil {
+		return nil, fmt.Errorf("parsing HTML: %w", err)
+	}
+
+	doc := &Document{
+		URL:    pageURL,
+		Root:   root,
+		Page:   page,
+		limits: limits,
+	}
+	for _, stage := range p.stages {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := stage.Extract(doc); err != nil {
+			fmt.Printf("Extraction stage %s failed for %s: %v\n", stage.Name(), pageURL, err)
+		}
+	}
+	return doc.Links, nil
+}
+
+// truncate cuts the content after its first maxTokens tokens, so the tree
+// is never built from more of the page than the limit allows.
+func truncate(content []byte, maxTokens int) []byte {
+	if maxTokens <= 0 {
+		return content
+	}
+
+	tokenizer := html.NewTokenizer(bytes.NewReader(content))
+	offset := 0
+	for i := 0; i < maxTokens; i++ {
+		if tokenizer.Next() == html.ErrorToken {
+			return content
+		}
+		offset += len(tokenizer.Raw())
+	}
+	return content[:offset]
+}
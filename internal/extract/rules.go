@@ -0,0 +1,190 @@
+package extract
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+	"gopkg.in/yaml.v3"
+)
+
+// Rule declares a site-specific field to extract with a CSS selector or an
+// XPath expression, for example:
+//
+//	rules:
+//	  - name: price
+//	    hosts: [shop.example.com]
+//	    css: "span.price"
+//	  - name: author
+//	    xpath: "//meta[@name='author']/@content"
+type Rule struct {
+	Name  string   `yaml:"name" json:"name"`
+	Hosts []string `yaml:"hosts,omitempty" json:"hosts,omitempty"` // Hosts the rule applies to, subdomains included; all if empty
+	CSS   string   `yaml:"css,omitempty" json:"css,omitempty"`
+	XPath string   `yaml:"xpath,omitempty" json:"xpath,omitempty"`
+	Attr  string   `yaml:"attr,omitempty" json:"attr,omitempty"` // Attribute to read instead of the text
+	All   bool     `yaml:"all,omitempty" json:"all,omitempty"`   // Keep every match as a list instead of the first
+}
+
+// RulesFile is the layout of an extraction rules file.
+type RulesFile struct {
+	Rules []Rule `yaml:"rules" json:"rules"`
+}
+
+// LoadRules reads extraction rules from a YAML or JSON file.
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file RulesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return file.Rules, nil
+}
+
+// LoadRuleStage reads and compiles the rules of a rules file.
+func LoadRuleStage(path string) (*RuleStage, error) {
+	rules, err := LoadRules(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewRuleStage(rules)
+}
+
+type compiledRule struct {
+	Rule
+	selector cascadia.Sel
+	expr     *xpath.Expr
+}
+
+// RuleStage extracts the fields declared by rules into the page's fields.
+type RuleStage struct {
+	rules []compiledRule
+}
+
+// NewRuleStage compiles the rules, reporting the first invalid one.
+func NewRuleStage(rules []Rule) (*RuleStage, error) {
+	stage := &RuleStage{}
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %d: missing name", i+1)
+		}
+		if (rule.CSS == "") == (rule.XPath == "") {
+			return nil, fmt.Errorf("rule %q: exactly one of css and xpath is required", rule.Name)
+		}
+
+		// Normalize a copy of the hosts, leaving the caller's rule as it was
+		compiled := compiledRule{Rule: rule}
+		compiled.Hosts = make([]string, len(rule.Hosts))
+		for j, host := range rule.Hosts {
+			compiled.Hosts[j] = strings.ToLower(strings.TrimPrefix(host, "."))
+		}
+
+		var err error
+		if rule.CSS != "" {
+			compiled.selector, err = cascadia.Parse(rule.CSS)
+		} else {
+			compiled.expr, err = xpath.Compile(rule.XPath)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		stage.rules = append(stage.rules, compiled)
+	}
+	return stage, nil
+}
+
+func (s *RuleStage) Name() string { return "rules" }
+
+func (s *RuleStage) Extract(doc *Document) error {
+	host := ""
+	if parsedURL, err := url.Parse(doc.URL); err == nil {
+		host = strings.ToLower(parsedURL.Hostname())
+	}
+
+	for _, rule := range s.rules {
+		if !rule.appliesTo(host) {
+			continue
+		}
+
+		values := rule.values(doc.Root)
+		if len(values) == 0 {
+			continue
+		}
+		if rule.All {
+			doc.SetField(rule.Name, values)
+		} else {
+			doc.SetField(rule.Name, values[0])
+		}
+	}
+	return nil
+}
+
+func (r compiledRule) appliesTo(host string) bool {
+	if len(r.Hosts) == 0 {
+		return true
+	}
+	for _, allowed := range r.Hosts {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// values returns the non-empty text or attribute values of the matches.
+func (r compiledRule) values(root *html.Node) []string {
+	var values []string
+	add := func(value string) {
+		if value = strings.Join(strings.Fields(value), " "); value != "" {
+			values = append(values, value)
+		}
+	}
+	addNode := func(n *html.Node) {
+		if r.Attr != "" {
+			add(attr(n, r.Attr))
+		} else {
+			add(htmlquery.InnerText(n))
+		}
+	}
+
+	if r.selector != nil {
+		if r.All {
+			for _, n := range cascadia.QueryAll(root, r.selector) {
+				addNode(n)
+			}
+		} else if n := cascadia.Query(root, r.selector); n != nil {
+			addNode(n)
+		}
+		return values
+	}
+
+	// Expressions such as string(//h1) evaluate to a value instead of nodes
+	switch result := r.expr.Evaluate(htmlquery.CreateXPathNavigator(root)).(type) {
+	case *xpath.NodeIterator:
+		for result.MoveNext() {
+			nav := result.Current()
+			if nav.NodeType() == xpath.AttributeNode {
+				add(nav.Value())
+			} else {
+				addNode(nav.(*htmlquery.NodeNavigator).Current())
+			}
+		}
+	case string:
+		add(result)
+	case float64:
+		add(strconv.FormatFloat(result, 'f', -1, 64))
+	case bool:
+		add(strconv.FormatBool(result))
+	}
+	return values
+}
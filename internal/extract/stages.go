@@ -0,0 +1,116 @@
+package extract
+
+import (
+	"strings"
+
+	"webcrawler/internal/utils"
+
+	"golang.org/x/net/html"
+)
+
+// LinkStage collects the targets of <a href> links.
+type LinkStage struct{}
+
+func (LinkStage) Name() string { return "links" }
+
+func (LinkStage) Extract(doc *Document) error {
+	doc.Walk(func(n *html.Node) bool {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			if ok, href := utils.GetHref(token(n), doc.URL); ok {
+				doc.Links = append(doc.Links, href)
+			}
+		}
+		return true
+	})
+	return nil
+}
+
+// MetadataStage reads the title, the canonical URL and the meta description,
+// which is stored as the "description" field.
+type MetadataStage struct{}
+
+func (MetadataStage) Name() string { return "metadata" }
+
+func (MetadataStage) Extract(doc *Document) error {
+	titleFound := false
+	doc.Walk(func(n *html.Node) bool {
+		if n.Type != html.ElementNode {
+			return true
+		}
+		switch n.Data {
+		case "title":
+			if !titleFound && n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
+				doc.Page.Title = n.FirstChild.Data
+				titleFound = true
+			}
+		case "link":
+			if isCanonicalLink(n) {
+				if ok, href := utils.GetHref(token(n), doc.URL); ok {
+					doc.Page.CanonicalURL = href
+				}
+			}
+		case "meta":
+			if strings.EqualFold(attr(n, "name"), "description") {
+				if description := strings.TrimSpace(attr(n, "content")); description != "" {
+					doc.SetField("description", description)
+				}
+			}
+		case "script", "style", "noscript", "svg":
+			return false
+		}
+		return true
+	})
+	return nil
+}
+
+// ContentStage collects the text of the body, leaving out scripts and
+// styles, up to the run's MaxContentChars characters.
+type ContentStage struct{}
+
+func (ContentStage) Name() string { return "content" }
+
+func (ContentStage) Extract(doc *Document) error {
+	var content strings.Builder
+	length := 0
+	body := false
+	maxChars := doc.Limits().MaxContentChars
+
+	doc.Walk(func(n *html.Node) bool {
+		switch n.Type {
+		case html.ElementNode:
+			switch n.Data {
+			case "body":
+				body = true
+			case "javascript", "script", "style", "noscript":
+				return false
+			}
+		case html.TextNode:
+			if body && (maxChars <= 0 || length < maxChars) {
+				content.WriteString(strings.TrimSpace(n.Data))
+				length += len(n.Data)
+			}
+		}
+		return true
+	})
+
+	doc.Page.Content = content.String()
+	return nil
+}
+
+// token converts an element back to the token form utils.GetHref expects.
+func token(n *html.Node) html.Token {
+	return html.Token{Type: html.StartTagToken, Data: n.Data, Attr: n.Attr}
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func isCanonicalLink(n *html.Node) bool {
+	return strings.EqualFold(strings.TrimSpace(attr(n, "rel")), "canonical")
+}
@@ -0,0 +1,379 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"webcrawler/internal/budget"
+	"webcrawler/internal/config"
+	"webcrawler/internal/crawler"
+	"webcrawler/internal/retry"
+	"webcrawler/internal/storage"
+)
+
+// DefaultJob is the job crawling the configured seeds, and the one the
+// API uses when no job is named.
+const DefaultJob = "default"
+
+// StateQueued is reported for jobs waiting for a free slot.
+const StateQueued crawler.State = "queued"
+
+var (
+	ErrJobExists   = errors.New("job already exists")
+	ErrJobNotFound = errors.New("job not found")
+	ErrInvalidName = errors.New("job names may only contain letters, digits, '-' and '_', up to 64 characters")
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Job is a named crawl with its own seeds, scope, budget, frontier, stats
+// and storage namespace.
+type Job struct {
+	Name      string
+	CreatedAt time.Time
+	Crawler   *crawler.Crawler
+
+	pending *crawler.Settings // Settings of a start waiting for a free slot
+}
+
+// Summary is a snapshot of a job's progress.
+type Summary struct {
+	TotalCrawled int            `json:"totalCrawled"`
+	TotalQueued  int            `json:"totalQueued"`
+	QueueSize    int            `json:"queueSize"`
+	Budget       budget.Report  `json:"budget"`
+	Retries      retry.Counters `json:"retries"`
+}
+
+// Info describes a job for the API.
+type Info struct {
+	Name      string         `json:"name"`
+	State     crawler.State  `json:"state"`
+	CreatedAt time.Time      `json:"createdAt"`
+	Crawl     crawler.Status `json:"crawl"`
+	Stats     Summary        `json:"stats"`
+}
+
+// Manager runs crawl jobs, at most maxActive at a time. Jobs started while
+// all slots are taken wait in order of their start.
+type Manager struct {
+	cfg       *config.Config
+	db        *storage.MongoDB
+	services  *crawler.Services
+	maxActive int
+	ctx       context.Context // Canceled to abort the fetches and writes of all jobs
+	cancel    context.CancelFunc
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	waiting []*Job
+}
+
+// NewManager returns a manager for jobs sharing the services. maxActive
+// values below 1 allow a single active job.
+func NewManager(cfg *config.Config, db *storage.MongoDB, services *crawler.Services, maxActive int) *Manager {
+	if maxActive < 1 {
+		maxActive = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		cfg:       cfg,
+		db:        db,
+		services:  services,
+		maxActive: maxActive,
+		ctx:       ctx,
+		cancel:    cancel,
+		jobs:      make(map[string]*Job),
+	}
+}
+
+// Services returns the services shared by all jobs.
+func (m *Manager) Services() *crawler.Services {
+	return m.services
+}
+
+// Create adds an idle job storing its pages in its own namespace.
+func (m *Manager) Create(name string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, err := m.newJobLocked(name)
+	if err != nil {
+		return nil, err
+	}
+	m.jobs[name] = job
+	return job, nil
+}
+
+// CreateAndStart adds a job and starts its crawl, or queues it until a slot
+// is free. A job whose crawl can't be started is not added.
+func (m *Manager) CreateAndStart(name string, settings crawler.Settings) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, err := m.newJobLocked(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.startOrQueueLocked(job, settings); err != nil {
+		return nil, err
+	}
+	m.jobs[name] = job
+	return job, nil
+}
+
+// newJobLocked returns an idle job for a name not taken yet. The caller
+// holds m.mu.
+func (m *Manager) newJobLocked(name string) (*Job, error) {
+	if !validName.MatchString(name) {
+		return nil, ErrInvalidName
+	}
+	if _, exists := m.jobs[name]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrJobExists, name)
+	}
+
+	return &Job{
+		Name:      name,
+		CreatedAt: time.Now(),
+		Crawler:   crawler.New(m.cfg, m.db.Namespace(name), m.services),
+	}, nil
+}
+
+func (m *Manager) Get(name string) (*Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[name]
+	return job, ok
+}
+
+// List returns the jobs sorted by creation time.
+func (m *Manager) List() []*Job {
+	m.mu.Lock()
+	jobs := make([]*Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, job)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// Start starts a crawl of the job, or queues it until a slot is free.
+func (m *Manager) Start(name string, settings crawler.Settings) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	return m.startOrQueueLocked(job, settings)
+}
+
+// startOrQueueLocked starts the job's crawl, or queues it while the maximum
+// number of jobs is active. The caller holds m.mu.
+func (m *Manager) startOrQueueLocked(job *Job, settings crawler.Settings) error {
+	if job.pending != nil {
+		return crawler.ErrActive
+	}
+
+	if m.activeCount() >= m.maxActive {
+		if isActive(job) {
+			return crawler.ErrActive
+		}
+		if err := crawler.ValidateSettings(settings); err != nil {
+			return err
+		}
+		job.pending = &settings
+		m.waiting = append(m.waiting, job)
+		fmt.Printf("Job %s queued, %d jobs are active\n", job.Name, m.maxActive)
+		return nil
+	}
+	return m.startLocked(job, settings)
+}
+
+// Stop stops the job's crawl, or takes it out of the queue.
+func (m *Manager) Stop(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	if job.pending != nil {
+		job.pending = nil
+		for i, waiting := range m.waiting {
+			if waiting == job {
+				m.waiting = append(m.waiting[:i], m.waiting[i+1:]...)
+				break
+			}
+		}
+		return nil
+	}
+	return job.Crawler.Stop()
+}
+
+// Info returns the job's state and progress.
+func (m *Manager) Info(job *Job) Info {
+	m.mu.Lock()
+	queued := job.pending != nil
+	m.mu.Unlock()
+
+	status := job.Crawler.Status()
+	state := status.State
+	if queued {
+		state = StateQueued
+	}
+
+	run := job.Crawler.Run()
+	return Info{
+		Name:      job.Name,
+		State:     state,
+		CreatedAt: job.CreatedAt,
+		Crawl:     status,
+		Stats: Summary{
+			TotalCrawled: run.Crawled.Size(),
+			TotalQueued:  run.Queue.TotalQueued(),
+			QueueSize:    run.Queue.Size(),
+			Budget:       run.Budget.Report(),
+			Retries:      run.Retries.Counters(),
+		},
+	}
+}
+
+// Wait blocks until no job is active or queued.
+func (m *Manager) Wait() {
+	for {
+		m.mu.Lock()
+		var active *Job
+		for _, job := range m.jobs {
+			if isActive(job) {
+				active = job
+				break
+			}
+		}
+		queued := len(m.waiting)
+		m.mu.Unlock()
+
+		switch {
+		case active != nil:
+			active.Crawler.Wait()
+		case queued > 0:
+			// A job just ended and the next one is about to start
+			time.Sleep(100 * time.Millisecond)
+		default:
+			return
+		}
+	}
+}
+
+// Shutdown stops every job, drops the queued ones and waits for the crawls
+// to end, which saves their frontiers. Once ctx is done, fetches and writes
+// still in progress are aborted and ctx's error is returned.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	for _, job := range m.waiting {
+		job.pending = nil
+	}
+	m.waiting = nil
+	for _, job := range m.jobs {
+		job.Crawler.Stop()
+	}
+	m.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		m.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+	}
+
+	fmt.Println("Drain timeout reached, aborting active crawls")
+	m.cancel()
+	select {
+	case <-drained:
+	case <-time.After(15 * time.Second):
+	}
+	return ctx.Err()
+}
+
+// SaveErrors joins the errors of the jobs whose last crawl was stopped but
+// could not save its frontier.
+func (m *Manager) SaveErrors() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs []error
+	for _, job := range m.jobs {
+		if err := job.Crawler.SaveError(); err != nil {
+			errs = append(errs, fmt.Errorf("job %s: frontier not saved: %w", job.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// startLocked starts the job's crawl and starts the next queued job when
+// it ends. The caller holds m.mu.
+func (m *Manager) startLocked(job *Job, settings crawler.Settings) error {
+	if err := job.Crawler.Start(m.ctx, settings); err != nil {
+		return err
+	}
+	fmt.Printf("Job %s started with %d seeds\n", job.Name, len(settings.Seeds))
+
+	go func() {
+		job.Crawler.Wait()
+		m.startWaiting()
+	}()
+	return nil
+}
+
+// startWaiting starts queued jobs while slots are free.
+func (m *Manager) startWaiting() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for len(m.waiting) > 0 && m.activeCount() < m.maxActive {
+		job := m.waiting[0]
+		m.waiting = m.waiting[1:]
+		settings := *job.pending
+		job.pending = nil
+		if err := m.startLocked(job, settings); err != nil {
+			fmt.Printf("Error starting queued job %s: %v\n", job.Name, err)
+		}
+	}
+}
+
+// activeCount counts jobs with a running, paused or stopping crawl. The
+// caller holds m.mu.
+func (m *Manager) activeCount() int {
+	count := 0
+	for _, job := range m.jobs {
+		if isActive(job) {
+			count++
+		}
+	}
+	return count
+}
+
+func isActive(job *Job) bool {
+	switch job.Crawler.Status().State {
+	case crawler.StateRunning, crawler.StatePaused, crawler.StateStopping:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+// Package metrics exposes the crawler's counters and histograms for
+// Prometheus.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"webcrawler/internal/utils"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "webcrawler"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	pagesFetched = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pages_fetched_total",
+		Help:      "Page fetches by response status class, or \"error\" when no response was received.",
+	}, []string{"status"})
+
+	fetchDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "fetch_duration_seconds",
+		Help:      "Time taken by page fetches that received a response.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60},
+	})
+
+	downloadedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "downloaded_bytes_total",
+		Help:      "Bytes of page and document bodies downloaded.",
+	})
+
+	robotsDenials = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "robots_denials_total",
+		Help:      "URLs not fetched or queued because robots.txt disallows them.",
+	})
+
+	budgetSkips = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "budget_skips_total",
+		Help:      "URLs not fetched because their host used up its page budget.",
+	})
+
+	retries = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retries_total",
+		Help:      "Failed fetches scheduled to be retried.",
+	})
+
+	storageErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_write_errors_total",
+		Help:      "Failed writes to storage by operation.",
+	}, []string{"operation"})
+
+	inFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "host_inflight_requests",
+		Help:      "Page fetches currently in progress by host.",
+	}, []string{"host"})
+
+	queueDepth = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "queue_depth"),
+		"URLs waiting in the frontier by crawl job.",
+		[]string{"crawl_job"}, nil,
+	)
+)
+
+// Storage operations counted by StorageError.
+const (
+	OpInsertPage    = "insert_page"
+	OpDeletePage    = "delete_page"
+	OpInsertFailure = "insert_failure"
+	OpSaveFrontier  = "save_frontier"
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		pagesFetched, fetchDuration, downloadedBytes, robotsDenials,
+		budgetSkips, retries, storageErrors, inFlight, &queueCollector{},
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Fetched records a page fetch. statusCode is 0 if no response was
+// received, in which case the latency is not observed.
+func Fetched(statusCode int, latency time.Duration, bytes int) {
+	if statusCode == 0 {
+		pagesFetched.WithLabelValues("error").Inc()
+		return
+	}
+	pagesFetched.WithLabelValues(strconv.Itoa(statusCode/100) + "xx").Inc()
+	fetchDuration.Observe(latency.Seconds())
+	downloadedBytes.Add(float64(bytes))
+}
+
+func RobotsDenied() {
+	robotsDenials.Inc()
+}
+
+func BudgetSkipped() {
+	budgetSkips.Inc()
+}
+
+func Retried() {
+	retries.Inc()
+}
+
+// StorageError records a failed write, one of the Op constants.
+func StorageError(operation string) {
+	storageErrors.WithLabelValues(operation).Inc()
+}
+
+// hosts counts the fetches in progress per host, so a host's series is
+// removed once it has none.
+var hosts = struct {
+	sync.Mutex
+	active map[string]int
+}{active: make(map[string]int)}
+
+// FetchStarted records a fetch of url starting. Every call must be
+// followed by FetchDone with the same URL.
+func FetchStarted(url string) {
+	host := hostOf(url)
+	hosts.Lock()
+	defer hosts.Unlock()
+	hosts.active[host]++
+	inFlight.WithLabelValues(host).Set(float64(hosts.active[host]))
+}
+
+func FetchDone(url string) {
+	host := hostOf(url)
+	hosts.Lock()
+	defer hosts.Unlock()
+	hosts.active[host]--
+	if hosts.active[host] <= 0 {
+		delete(hosts.active, host)
+		inFlight.DeleteLabelValues(host)
+		return
+	}
+	inFlight.WithLabelValues(host).Set(float64(hosts.active[host]))
+}
+
+func hostOf(url string) string {
+	if host := utils.HostOf(url); host != "" {
+		return host
+	}
+	return "unknown"
+}
+
+// queueSizes returns the frontier size of each crawl job when scraped.
+var queueSizes struct {
+	sync.Mutex
+	fn func() map[string]int
+}
+
+// SetQueueDepth sets the function reporting the frontier size of each crawl
+// job, read on every scrape.
+func SetQueueDepth(fn func() map[string]int) {
+	queueSizes.Lock()
+	defer queueSizes.Unlock()
+	queueSizes.fn = fn
+}
+
+// queueCollector reports the queue depth gauge from SetQueueDepth.
+type queueCollector struct{}
+
+func (*queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepth
+}
+
+func (*queueCollector) Collect(ch chan<- prometheus.Metric) {
+	queueSizes.Lock()
+	fn := queueSizes.fn
+	queueSizes.Unlock()
+	if fn == nil {
+		return
+	}
+
+	for job, size := range fn() {
+		ch <- prometheus.MustNewConstMetric(queueDepth, prometheus.GaugeValue, float64(size), job)
+	}
+}
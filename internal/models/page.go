@@ -1,8 +1,50 @@
 package models
 
+import "time"
+
 type Page struct {
-	Url     string  `json:"url"`
-	Title   string  `json:"title"`
-	Content string  `json:"content"`
-	Score   float64 `json:"score,omitempty"` // Search relevance score
+	Job           string    `json:"job,omitempty"` // Crawl job that stored the page
+	Url           string    `json:"url"`
+	Title         string    `json:"title"`
+	Content       string    `json:"content"`
+	DocType       string    `json:"docType,omitempty"` // html, pdf, text or feed
+	Depth         int       `json:"depth"`
+	ParentChain   []string  `json:"parentChain,omitempty"` // Seed first, direct parent last
+	DiscoveredAt  time.Time `json:"discoveredAt"`
+	FetchAttempts int       `json:"fetchAttempts"`
+
+	// Recrawl state
+	ETag            string        `json:"etag,omitempty"`
+	LastModified    string        `json:"lastModified,omitempty"`
+	ContentHash     string        `json:"contentHash,omitempty"`
+	ChangeFreq      string        `json:"changeFreq,omitempty"` // From the sitemap
+	FetchedAt       time.Time     `json:"fetchedAt"`
+	LastChangedAt   time.Time     `json:"lastChangedAt"`
+	ChangeCount     int           `json:"changeCount"` // Revisits that found new content
+	CheckCount      int           `json:"checkCount"`  // Revisits in total
+	RevisitInterval time.Duration `json:"revisitInterval"`
+	NextVisitAt     time.Time     `json:"nextVisitAt"`
+
+	// Near-duplicate detection
+	Fingerprint  string `json:"fingerprint,omitempty"`  // SimHash of title and content, hex encoded
+	CanonicalURL string `json:"canonicalUrl,omitempty"` // From <link rel="canonical">
+	ClusterID    string `json:"clusterId,omitempty"`
+
+	// Site-specific values from extraction rules, such as price or author
+	Fields map[string]interface{} `json:"fields,omitempty"`
+
+	Score float64 `json:"score,omitempty"` // Search relevance score
+}
+
+// FailedFetch records a URL the crawler gave up on.
+type FailedFetch struct {
+	Job         string    `json:"job,omitempty"`
+	Url         string    `json:"url"`
+	Attempts    int       `json:"attempts"`
+	Reason      string    `json:"reason"`
+	StatusCode  int       `json:"statusCode,omitempty"`
+	Error       string    `json:"error"`
+	Depth       int       `json:"depth"`
+	ParentChain []string  `json:"parentChain,omitempty"`
+	FailedAt    time.Time `json:"failedAt"`
 }
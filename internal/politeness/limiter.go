@@ -0,0 +1,155 @@
+package politeness
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"webcrawler/internal/utils"
+)
+
+// Config bounds the delay between requests to one host. MinDelay sets the
+// fastest rate the limiter will speed up to and MaxDelay the slowest it will
+// back off to. A robots.txt Crawl-delay above the adaptive delay always wins.
+type Config struct {
+	MinDelay       time.Duration
+	MaxDelay       time.Duration
+	InitialDelay   time.Duration
+	TargetLatency  time.Duration // Average latency above which a host is slowed down
+	HealthyStreak  int           // Healthy responses in a row before speeding up
+	BackoffFactor  float64       // Delay multiplier on 429, 503 and errors
+	SlowdownFactor float64       // Delay multiplier when latency is above target
+	SpeedupFactor  float64       // Delay multiplier after a healthy streak
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MinDelay:       500 * time.Millisecond,
+		MaxDelay:       60 * time.Second,
+		InitialDelay:   1 * time.Second,
+		TargetLatency:  3 * time.Second,
+		HealthyStreak:  5,
+		BackoffFactor:  2.0,
+		SlowdownFactor: 1.5,
+		SpeedupFactor:  0.8,
+	}
+}
+
+type hostState struct {
+	delay       time.Duration
+	nextAllowed time.Time
+	avgLatency  time.Duration // Exponentially weighted moving average
+	streak      int
+}
+
+// HostRate is a snapshot of one host's throttling state.
+type HostRate struct {
+	Delay      time.Duration
+	AvgLatency time.Duration
+}
+
+// Limiter spaces out requests per host, adapting the delay to how the host
+// responds: it backs off on 429, 503, errors and rising latency, and speeds
+// up cautiously while responses stay healthy.
+type Limiter struct {
+	cfg   Config
+	hosts map[string]*hostState
+	mu    sync.Mutex
+}
+
+func NewLimiter(cfg Config) *Limiter {
+	return &Limiter{
+		cfg:   cfg,
+		hosts: make(map[string]*hostState),
+	}
+}
+
+// Reserve returns how long to wait before the URL's host may be requested
+// again. When it returns 0 the request slot is claimed and the caller should
+// fetch right away. crawlDelay is the robots.txt Crawl-delay, or 0 if none.
+func (l *Limiter) Reserve(rawURL string, crawlDelay time.Duration) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state := l.state(utils.HostOf(rawURL))
+	now := time.Now()
+	if state.nextAllowed.After(now) {
+		return state.nextAllowed.Sub(now)
+	}
+
+	delay := state.delay
+	if crawlDelay > delay {
+		delay = crawlDelay
+	}
+	state.nextAllowed = now.Add(delay)
+	return 0
+}
+
+// Record adjusts the host's delay from a response. statusCode is 0 when no
+// response was received.
+func (l *Limiter) Record(rawURL string, latency time.Duration, statusCode int, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state := l.state(utils.HostOf(rawURL))
+	if state.avgLatency == 0 {
+		state.avgLatency = latency
+	} else {
+		state.avgLatency = (state.avgLatency*7 + latency*3) / 10
+	}
+
+	switch {
+	case statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable || (err != nil && statusCode == 0):
+		state.streak = 0
+		state.delay = l.scale(state.delay, l.cfg.BackoffFactor)
+	case l.cfg.TargetLatency > 0 && state.avgLatency > l.cfg.TargetLatency:
+		state.streak = 0
+		state.delay = l.scale(state.delay, l.cfg.SlowdownFactor)
+	default:
+		state.streak++
+		if state.streak >= l.cfg.HealthyStreak {
+			state.streak = 0
+			state.delay = l.scale(state.delay, l.cfg.SpeedupFactor)
+		}
+	}
+}
+
+// Rates returns the current throttling state of every host seen so far.
+func (l *Limiter) Rates() map[string]HostRate {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := make(map[string]HostRate, len(l.hosts))
+	for host, state := range l.hosts {
+		result[host] = HostRate{Delay: state.delay, AvgLatency: state.avgLatency}
+	}
+	return result
+}
+
+func (l *Limiter) state(host string) *hostState {
+	state, exists := l.hosts[host]
+	if !exists {
+		state = &hostState{delay: l.clamp(l.cfg.InitialDelay)}
+		l.hosts[host] = state
+	}
+	return state
+}
+
+// scale multiplies the delay within the configured bounds. A zero delay
+// backs off from one second, since multiplying it would keep it at zero.
+func (l *Limiter) scale(delay time.Duration, factor float64) time.Duration {
+	if delay <= 0 && factor > 1 {
+		delay = time.Second
+	}
+	return l.clamp(time.Duration(float64(delay) * factor))
+}
+
+func (l *Limiter) clamp(delay time.Duration) time.Duration {
+	if delay < l.cfg.MinDelay {
+		delay = l.cfg.MinDelay
+	}
+	if l.cfg.MaxDelay > 0 && delay > l.cfg.MaxDelay {
+		delay = l.cfg.MaxDelay
+	}
+	return delay
+}
@@ -35,3 +35,29 @@ func (c *CrawledSet) Size() int {
 	defer c.mu.Unlock()
 	return c.number
 }
+
+// Hashes returns the hashes of the crawled URLs, e.g. to save the state of
+// an unfinished crawl.
+func (c *CrawledSet) Hashes() []uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hashes := make([]uint64, 0, len(c.data))
+	for hash := range c.data {
+		hashes = append(hashes, hash)
+	}
+	return hashes
+}
+
+// AddHashes marks URLs as crawled by their hashes, restoring saved state.
+func (c *CrawledSet) AddHashes(hashes []uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, hash := range hashes {
+		if !c.data[hash] {
+			c.data[hash] = true
+			c.number++
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package queue
+
+import (
+	"net/url"
+	"strings"
+)
+
+// DepthLimits caps how many links away from a seed the crawler will go.
+// A zero limit means unlimited.
+type DepthLimits struct {
+	MaxDepth  int
+	PerDomain map[string]int // Keyed by domain, also applies to its subdomains
+}
+
+// Allows reports whether the entry is within the limits. The depth of the
+// entry's seed, if set, replaces them.
+func (d DepthLimits) Allows(entry Entry) bool {
+	limit := d.MaxDepth
+	if domainLimit, ok := d.domainLimit(entry.URL); ok {
+		limit = domainLimit
+	}
+	if entry.Seed != nil && entry.Seed.MaxDepth > 0 {
+		limit = entry.Seed.MaxDepth
+	}
+	return limit <= 0 || entry.Depth <= limit
+}
+
+// domainLimit returns the limit for the most specific domain matching the URL host.
+func (d DepthLimits) domainLimit(rawURL string) (int, bool) {
+	if len(d.PerDomain) == 0 {
+		return 0, false
+	}
+
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, false
+	}
+
+	host := strings.ToLower(parsedURL.Hostname())
+	for host != "" {
+		if limit, exists := d.PerDomain[host]; exists {
+			return limit, true
+		}
+		dot := strings.Index(host, ".")
+		if dot < 0 {
+			break
+		}
+		host = host[dot+1:]
+	}
+
+	return 0, false
+}
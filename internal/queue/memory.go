@@ -1,48 +1,333 @@
 package queue
 
-import "sync"
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
 
+	"webcrawler/internal/models"
+	"webcrawler/internal/utils"
+)
+
+// SeedPriority is the priority given to seed URLs so they are crawled first.
+const SeedPriority = 1.0
+
+// Entry is a URL waiting to be crawled along with how the crawler reached it.
+type Entry struct {
+	URL          string
+	Depth        int
+	Parent       string
+	ParentChain  []string // Ancestors from the seed down to Parent
+	DiscoveredAt time.Time
+
+	// Scheduling hints. Entries with a higher Priority are dequeued first,
+	// entries with equal priority in the order they were enqueued.
+	Priority   float64
+	LastMod    time.Time // From a sitemap, zero if unknown
+	ChangeFreq string    // From a sitemap, empty if unknown
+
+	Attempts  int       // Fetch attempts made so far
+	NotBefore time.Time // Set for deferred entries, see Queue.Defer
+	Marked    bool      // Already added to the crawled set
+
+	Previous *models.Page // Stored version when revisiting a page, nil otherwise
+
+	Seed *SeedOptions // Limits of the seed the entry was reached from, nil if it has none
+}
+
+// SeedOptions are limits of a seed that replace the crawl's for every page
+// reached from it.
+type SeedOptions struct {
+	Host     string // Host of the seed, which Scope is relative to
+	MaxDepth int    // 0 keeps the crawl's depth limits
+	Scope    string // Scope mode, empty keeps the crawl's
+}
+
+// NewRevisitEntry returns an entry for revisiting a stored page.
+func NewRevisitEntry(page models.Page) Entry {
+	return Entry{
+		URL:          page.Url,
+		Depth:        page.Depth,
+		ParentChain:  page.ParentChain,
+		DiscoveredAt: page.DiscoveredAt,
+		Priority:     SeedPriority,
+		ChangeFreq:   page.ChangeFreq,
+		Previous:     &page,
+	}
+}
+
+// NewSeedEntry returns a depth 0 entry with no parent.
+func NewSeedEntry(url string) Entry {
+	return Entry{
+		URL:          url,
+		DiscoveredAt: time.Now(),
+		Priority:     SeedPriority,
+	}
+}
+
+// Child returns an entry for a URL discovered on this entry's page.
+func (e Entry) Child(url string) Entry {
+	chain := make([]string, len(e.ParentChain), len(e.ParentChain)+1)
+	copy(chain, e.ParentChain)
+
+	return Entry{
+		URL:          url,
+		Depth:        e.Depth + 1,
+		Parent:       e.URL,
+		ParentChain:  append(chain, e.URL),
+		DiscoveredAt: time.Now(),
+		Seed:         e.Seed,
+	}
+}
+
+// Queue is the frontier of a crawl. Entries are kept per host, so a host
+// held back by Hold doesn't hold up the others.
 type Queue struct {
 	totalQueued int
 	number      int
-	elements    []string
+	hosts       map[string]*hostQueue
+	deferred    []Entry
+	queued      map[string]struct{} // URLs of the queued and deferred entries
+	depthLimits DepthLimits
 	mu          sync.Mutex
 }
 
+// hostQueue holds the queued entries of one host.
+type hostQueue struct {
+	entries entryHeap
+	readyAt time.Time // No entry is dequeued before, see Queue.Hold
+}
+
 func NewQueue() *Queue {
 	return &Queue{
 		totalQueued: 0,
 		number:      0,
-		elements:    make([]string, 0),
+		hosts:       make(map[string]*hostQueue),
+		queued:      make(map[string]struct{}),
 	}
 }
 
-func (q *Queue) Enqueue(url string, crawled *CrawledSet) {
+// SetDepthLimits sets the limits checked by Enqueue.
+func (q *Queue) SetDepthLimits(limits DepthLimits) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.depthLimits = limits
+}
+
+// Enqueue adds the entry unless it was already crawled, is already queued or
+// exceeds the depth limits. It reports whether the entry was added.
+func (q *Queue) Enqueue(entry Entry, crawled *CrawledSet) bool {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
-	if crawled.Contains(url) {
-		return
+	if crawled.Contains(entry.URL) {
+		return false
 	}
 
-	for _, existing := range q.elements {
-		if existing == url {
-			return
-		}
+	if !q.depthLimits.Allows(entry) {
+		return false
+	}
+
+	if _, exists := q.queued[entry.URL]; exists {
+		return false
 	}
 
-	q.elements = append(q.elements, url)
+	q.queued[entry.URL] = struct{}{}
+	q.push(entry)
 	q.totalQueued++
 	q.number++
+	return true
+}
+
+// Defer puts a dequeued entry back to be dequeued again no earlier than
+// the given time, e.g. to retry a failed fetch. It skips the duplicate checks
+// and does not count towards TotalQueued.
+func (q *Queue) Defer(entry Entry, until time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entry.NotBefore = until
+	q.deferred = append(q.deferred, entry)
+	q.queued[entry.URL] = struct{}{}
+	q.number++
+}
+
+// DeferHost defers the entry like Defer and holds back the other entries of
+// its host until the same time, e.g. while the host must not be requested.
+func (q *Queue) DeferHost(entry Entry, until time.Time) {
+	q.Hold(entry.URL, until)
+	q.Defer(entry, until)
+}
+
+// Hold keeps the entries of the URL's host from being dequeued before the
+// given time. Entries of other hosts are dequeued meanwhile.
+func (q *Queue) Hold(rawURL string, until time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	hosted := q.host(utils.HostOf(rawURL))
+	if until.After(hosted.readyAt) {
+		hosted.readyAt = until
+	}
 }
 
-func (q *Queue) Dequeue() string {
+// Dequeue returns the highest priority entry of the hosts that are not held
+// back. If there is none, it waits until a host is ready or a deferred entry
+// is due, or the context is done. The queue must not be empty.
+func (q *Queue) Dequeue(ctx context.Context) (Entry, error) {
+	for {
+		q.mu.Lock()
+		now := time.Now()
+		wait := q.promoteDeferred(now)
+		if entry, ok := q.pop(now); ok {
+			delete(q.queued, entry.URL)
+			q.number--
+			q.mu.Unlock()
+			return entry, nil
+		}
+		if ready := q.nextReady(now); ready > 0 && (wait == 0 || ready < wait) {
+			wait = ready
+		}
+		q.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return Entry{}, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Entries returns a copy of the queued and deferred entries, e.g. to save
+// the frontier of an unfinished crawl.
+func (q *Queue) Entries() []Entry {
 	q.mu.Lock()
 	defer q.mu.Unlock()
-	url := q.elements[0]
-	q.elements = q.elements[1:]
-	q.number--
-	return url
+
+	entries := make([]Entry, 0, q.number)
+	for _, hosted := range q.hosts {
+		for _, queued := range hosted.entries {
+			entries = append(entries, queued.Entry)
+		}
+	}
+	return append(entries, q.deferred...)
+}
+
+// Restore queues entries of a saved frontier without the duplicate checks.
+// Deferred entries stay deferred until their NotBefore time.
+func (q *Queue) Restore(entries []Entry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, entry := range entries {
+		q.queued[entry.URL] = struct{}{}
+		if !entry.NotBefore.IsZero() {
+			q.deferred = append(q.deferred, entry)
+		} else {
+			q.push(entry)
+			q.totalQueued++
+		}
+		q.number++
+	}
+}
+
+// HostSizes returns how many queued and deferred entries each host has.
+func (q *Queue) HostSizes() map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	sizes := make(map[string]int)
+	for host, hosted := range q.hosts {
+		if len(hosted.entries) > 0 {
+			sizes[host] += len(hosted.entries)
+		}
+	}
+	for _, entry := range q.deferred {
+		sizes[utils.HostOf(entry.URL)]++
+	}
+	return sizes
+}
+
+// promoteDeferred moves due deferred entries into the heap and returns how
+// long until the next one is due.
+func (q *Queue) promoteDeferred(now time.Time) time.Duration {
+	var wait time.Duration
+	remaining := q.deferred[:0]
+	for _, entry := range q.deferred {
+		if !entry.NotBefore.After(now) {
+			q.push(entry)
+			continue
+		}
+		if until := entry.NotBefore.Sub(now); wait == 0 || until < wait {
+			wait = until
+		}
+		remaining = append(remaining, entry)
+	}
+	q.deferred = remaining
+	return wait
+}
+
+// push adds the entry to its host's heap, after the entries queued so far
+// with the same priority. The caller holds q.mu.
+func (q *Queue) push(entry Entry) {
+	hosted := q.host(utils.HostOf(entry.URL))
+	heap.Push(&hosted.entries, queuedEntry{Entry: entry, seq: q.totalQueued})
+}
+
+// pop removes the highest priority entry of the hosts ready at now. Hosts
+// left without entries are forgotten once they are ready. The caller holds
+// q.mu.
+func (q *Queue) pop(now time.Time) (Entry, bool) {
+	var best *hostQueue
+	var bestHost string
+	for host, hosted := range q.hosts {
+		if hosted.readyAt.After(now) {
+			continue
+		}
+		if len(hosted.entries) == 0 {
+			delete(q.hosts, host)
+			continue
+		}
+		if best == nil || hosted.entries[0].before(best.entries[0]) {
+			best, bestHost = hosted, host
+		}
+	}
+	if best == nil {
+		return Entry{}, false
+	}
+
+	entry := heap.Pop(&best.entries).(queuedEntry).Entry
+	if len(best.entries) == 0 {
+		delete(q.hosts, bestHost)
+	}
+	return entry, true
+}
+
+// nextReady returns how long until the first held host with entries is
+// ready, 0 if there is none. The caller holds q.mu.
+func (q *Queue) nextReady(now time.Time) time.Duration {
+	var wait time.Duration
+	for _, hosted := range q.hosts {
+		if len(hosted.entries) == 0 || !hosted.readyAt.After(now) {
+			continue
+		}
+		if until := hosted.readyAt.Sub(now); wait == 0 || until < wait {
+			wait = until
+		}
+	}
+	return wait
+}
+
+// host returns the queue of a host. The caller holds q.mu.
+func (q *Queue) host(host string) *hostQueue {
+	hosted, exists := q.hosts[host]
+	if !exists {
+		hosted = &hostQueue{}
+		q.hosts[host] = hosted
+	}
+	return hosted
 }
 
 func (q *Queue) Size() int {
@@ -56,3 +341,36 @@ func (q *Queue) TotalQueued() int {
 	defer q.mu.Unlock()
 	return q.totalQueued
 }
+
+type queuedEntry struct {
+	Entry
+	seq int // Enqueue order, breaks priority ties
+}
+
+// before reports whether e is dequeued before other: higher priority first,
+// then in enqueue order.
+func (e queuedEntry) before(other queuedEntry) bool {
+	if e.Priority != other.Priority {
+		return e.Priority > other.Priority
+	}
+	return e.seq < other.seq
+}
+
+// entryHeap implements heap.Interface, highest priority first.
+type entryHeap []queuedEntry
+
+func (h entryHeap) Len() int { return len(h) }
+
+func (h entryHeap) Less(i, j int) bool { return h[i].before(h[j]) }
+
+func (h entryHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *entryHeap) Push(x any) { *h = append(*h, x.(queuedEntry)) }
+
+func (h *entryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
@@ -0,0 +1,108 @@
+package recrawl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"webcrawler/internal/models"
+)
+
+// Config bounds how often a stored page is revisited. The interval halves
+// each time a page is found changed and grows by half each time it is not.
+type Config struct {
+	DefaultInterval time.Duration // First interval when the sitemap gives no changefreq
+	MinInterval     time.Duration
+	MaxInterval     time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		DefaultInterval: 24 * time.Hour,
+		MinInterval:     1 * time.Hour,
+		MaxInterval:     30 * 24 * time.Hour,
+	}
+}
+
+// ContentHash fingerprints the extracted text of a page, so markup-only
+// changes such as rotating script nonces do not count as changes.
+func ContentHash(page models.Page) string {
+	sum := sha256.Sum256([]byte(page.Title + "\n" + page.Content))
+	return hex.EncodeToString(sum[:])
+}
+
+// Changed records a fresh fetch of the page, comparing it with the stored
+// version if there is one, and schedules the next visit.
+func (c Config) Changed(page *models.Page, previous *models.Page, now time.Time) {
+	page.ContentHash = ContentHash(*page)
+	page.FetchedAt = now
+
+	if previous == nil {
+		page.LastChangedAt = now
+		page.RevisitInterval = c.clamp(c.initialInterval(page.ChangeFreq))
+		page.NextVisitAt = now.Add(page.RevisitInterval)
+		return
+	}
+
+	page.CheckCount = previous.CheckCount + 1
+	page.ChangeCount = previous.ChangeCount
+	page.LastChangedAt = previous.LastChangedAt
+	interval := previous.RevisitInterval
+	if interval == 0 {
+		interval = c.initialInterval(page.ChangeFreq)
+	}
+
+	if page.ContentHash != previous.ContentHash {
+		page.ChangeCount++
+		page.LastChangedAt = now
+		interval /= 2
+	} else {
+		interval += interval / 2
+	}
+
+	page.RevisitInterval = c.clamp(interval)
+	page.NextVisitAt = now.Add(page.RevisitInterval)
+}
+
+// NotModified returns the stored page updated for a 304 response: it is
+// unchanged, so the next visit moves further out.
+func (c Config) NotModified(previous models.Page, now time.Time) models.Page {
+	page := previous
+	page.FetchedAt = now
+	page.CheckCount++
+
+	interval := previous.RevisitInterval
+	if interval == 0 {
+		interval = c.initialInterval(page.ChangeFreq)
+	}
+	page.RevisitInterval = c.clamp(interval + interval/2)
+	page.NextVisitAt = now.Add(page.RevisitInterval)
+	return page
+}
+
+// initialInterval turns a sitemap changefreq into a first revisit interval.
+func (c Config) initialInterval(changeFreq string) time.Duration {
+	switch changeFreq {
+	case "always", "hourly":
+		return time.Hour
+	case "daily":
+		return 24 * time.Hour
+	case "weekly":
+		return 7 * 24 * time.Hour
+	case "monthly":
+		return 30 * 24 * time.Hour
+	case "yearly", "never":
+		return 365 * 24 * time.Hour
+	}
+	return c.DefaultInterval
+}
+
+func (c Config) clamp(interval time.Duration) time.Duration {
+	if interval < c.MinInterval {
+		interval = c.MinInterval
+	}
+	if c.MaxInterval > 0 && interval > c.MaxInterval {
+		interval = c.MaxInterval
+	}
+	return interval
+}
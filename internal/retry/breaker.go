@@ -0,0 +1,121 @@
+package retry
+
+import (
+	"sync"
+	"time"
+
+	"webcrawler/internal/utils"
+)
+
+// BreakerConfig controls when a host's circuit opens and for how long.
+type BreakerConfig struct {
+	FailureThreshold int           // Consecutive failures that open the circuit, 0 disables the breaker
+	Cooldown         time.Duration // First pause, doubled each time a trial request fails
+	MaxCooldown      time.Duration
+}
+
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		FailureThreshold: 5,
+		Cooldown:         1 * time.Minute,
+		MaxCooldown:      30 * time.Minute,
+	}
+}
+
+type hostCircuit struct {
+	failures  int
+	openUntil time.Time
+	cooldown  time.Duration
+}
+
+// Breaker is a per-host circuit breaker. After FailureThreshold consecutive
+// failures a host is paused for the cooldown. Once it passes, the next
+// request is a trial: success closes the circuit, failure reopens it with a
+// doubled cooldown.
+type Breaker struct {
+	cfg   BreakerConfig
+	hosts map[string]*hostCircuit
+	mu    sync.Mutex
+}
+
+func NewBreaker(cfg BreakerConfig) *Breaker {
+	return &Breaker{
+		cfg:   cfg,
+		hosts: make(map[string]*hostCircuit),
+	}
+}
+
+// OpenUntil returns when the URL's host may be fetched again, or the zero
+// time if it may be fetched now.
+func (b *Breaker) OpenUntil(rawURL string) time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	circuit, exists := b.hosts[utils.HostOf(rawURL)]
+	if !exists || !time.Now().Before(circuit.openUntil) {
+		return time.Time{}
+	}
+	return circuit.openUntil
+}
+
+// Success records a successful fetch, closing the host's circuit.
+func (b *Breaker) Success(rawURL string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if circuit, exists := b.hosts[utils.HostOf(rawURL)]; exists {
+		circuit.failures = 0
+		circuit.cooldown = 0
+	}
+}
+
+// Failure records a failed fetch. It reports whether this opened the circuit.
+func (b *Breaker) Failure(rawURL string) bool {
+	if b.cfg.FailureThreshold <= 0 {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	host := utils.HostOf(rawURL)
+	circuit, exists := b.hosts[host]
+	if !exists {
+		circuit = &hostCircuit{}
+		b.hosts[host] = circuit
+	}
+
+	circuit.failures++
+	if circuit.failures < b.cfg.FailureThreshold {
+		return false
+	}
+
+	// A failed trial after a cooldown doubles the next one
+	if circuit.cooldown == 0 {
+		circuit.cooldown = b.cfg.Cooldown
+	} else {
+		circuit.cooldown *= 2
+	}
+	if b.cfg.MaxCooldown > 0 && circuit.cooldown > b.cfg.MaxCooldown {
+		circuit.cooldown = b.cfg.MaxCooldown
+	}
+
+	circuit.openUntil = time.Now().Add(circuit.cooldown)
+	circuit.failures = b.cfg.FailureThreshold - 1 // The trial request decides
+	return true
+}
+
+// OpenHosts returns the hosts whose circuit is currently open.
+func (b *Breaker) OpenHosts() map[string]time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	result := make(map[string]time.Time)
+	for host, circuit := range b.hosts {
+		if now.Before(circuit.openUntil) {
+			result[host] = circuit.openUntil
+		}
+	}
+	return result
+}
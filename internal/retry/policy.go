@@ -0,0 +1,115 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Policy decides whether and when a failed fetch is retried.
+type Policy struct {
+	MaxAttempts   int           // Total attempts including the first
+	BaseDelay     time.Duration // Delay before the first retry
+	MaxDelay      time.Duration // Cap for the backoff and for Retry-After, 0 for none
+	JitterPercent int           // Random +/- spread applied to each delay
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:   4,
+		BaseDelay:     2 * time.Second,
+		MaxDelay:      5 * time.Minute,
+		JitterPercent: 20,
+	}
+}
+
+// ShouldRetry reports whether another attempt is allowed after the given
+// number of attempts failed with a transient error.
+func (p Policy) ShouldRetry(attempts int, transient bool) bool {
+	return transient && attempts < p.MaxAttempts
+}
+
+// Backoff returns the delay before the next attempt: exponential in the
+// number of attempts so far, with jitter, unless the server asked for a
+// longer delay through Retry-After. Both are capped at MaxDelay, if set.
+func (p Policy) Backoff(attempts int, retryAfter time.Duration) time.Duration {
+	limit := p.MaxDelay
+	if limit <= 0 {
+		limit = math.MaxInt64 / 2 // Doubling stops before it overflows
+	}
+	delay := p.BaseDelay
+	for i := 1; i < attempts && delay < limit; i++ {
+		delay *= 2
+	}
+
+	if p.JitterPercent > 0 && delay > 0 {
+		spread := int64(delay) / 100 * int64(p.JitterPercent)
+		if spread > 0 {
+			delay += time.Duration(rand.Int63n(2*spread+1) - spread)
+		}
+	}
+
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// Classify reports whether a fetch failure is transient and gives a short
+// reason for it. statusCode is 0 when no response was received.
+func Classify(err error, statusCode int) (transient bool, reason string) {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true, fmt.Sprintf("http %d", statusCode)
+	}
+	if statusCode >= 400 {
+		return false, fmt.Sprintf("http %d", statusCode)
+	}
+
+	if err == nil {
+		return false, ""
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true, "timeout"
+	}
+
+	// Errors of the HTTP client and the document fetches
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		return dnsErr.IsTimeout || dnsErr.IsTemporary, "dns failure"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return true, "timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return true, "connection refused"
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return true, "connection reset"
+	}
+
+	// Chrome reports network failures as net::ERR_* strings
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "ERR_TIMED_OUT"), strings.Contains(message, "ERR_CONNECTION_TIMED_OUT"):
+		return true, "timeout"
+	case strings.Contains(message, "ERR_CONNECTION_RESET"), strings.Contains(message, "ERR_CONNECTION_CLOSED"),
+		strings.Contains(message, "ERR_EMPTY_RESPONSE"), strings.Contains(message, "connection reset"):
+		return true, "connection reset"
+	case strings.Contains(message, "ERR_NETWORK_CHANGED"), strings.Contains(message, "ERR_CONNECTION_REFUSED"):
+		return true, "connection refused"
+	case strings.Contains(message, "ERR_NAME_NOT_RESOLVED"):
+		return false, "dns failure"
+	}
+	return false, "fetch error"
+}
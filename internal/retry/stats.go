@@ -0,0 +1,55 @@
+package retry
+
+import "sync"
+
+// Counters summarizes retries and permanent failures.
+type Counters struct {
+	Retries        int            `json:"retries"`
+	FailedURLs     int            `json:"failedUrls"`
+	FailureReasons map[string]int `json:"failureReasons"`
+	BreakerTrips   int            `json:"breakerTrips"`
+}
+
+// Stats counts retries, permanent failures by reason and circuit breaker trips.
+type Stats struct {
+	counters Counters
+	mu       sync.Mutex
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		counters: Counters{FailureReasons: make(map[string]int)},
+	}
+}
+
+func (s *Stats) Retry() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters.Retries++
+}
+
+func (s *Stats) Failure(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters.FailedURLs++
+	s.counters.FailureReasons[reason]++
+}
+
+func (s *Stats) BreakerTrip() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters.BreakerTrips++
+}
+
+// Counters returns a snapshot of the counters.
+func (s *Stats) Counters() Counters {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.counters
+	snapshot.FailureReasons = make(map[string]int, len(s.counters.FailureReasons))
+	for reason, count := range s.counters.FailureReasons {
+		snapshot.FailureReasons[reason] = count
+	}
+	return snapshot
+}
@@ -0,0 +1,126 @@
+package robots
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Decision explains whether a URL may be crawled.
+type Decision struct {
+	URL        string
+	Allowed    bool
+	Reason     string // Human readable explanation
+	Rule       string // Deciding rule such as "Disallow: /private", empty if none matched
+	Group      string // User-agent group the rules came from, empty if none applied
+	CrawlDelay time.Duration
+	Status     FetchStatus // Status of the host's robots.txt, empty if the URL is invalid
+}
+
+// HostInfo is the cached robots.txt state of a host.
+type HostInfo struct {
+	Host         string
+	Status       FetchStatus
+	StatusCode   int
+	Error        string
+	FetchedAt    time.Time
+	ExpiresAt    time.Time
+	RobotsTxt    *RobotsTxt // nil when there are no rules, e.g. a 404
+	AppliedGroup string     // Group this crawler follows, empty if none
+}
+
+// Check decides whether the URL may be crawled and explains why, fetching
+// the host's robots.txt if it is not cached. Canceling ctx aborts the fetch,
+// which disallows the URL.
+func (rc *RobotsChecker) Check(ctx context.Context, targetURL string) Decision {
+	decision := Decision{URL: targetURL, Allowed: true}
+
+	parsedURL, err := url.Parse(targetURL)
+	if err != nil {
+		decision.Reason = "URL could not be parsed, allowed by default"
+		return decision
+	}
+
+	domain := parsedURL.Scheme + "://" + parsedURL.Host
+	entry := rc.getRobotsTxt(ctx, domain)
+	decision.Status = entry.status
+	robotsTxt, disallowAll := entry.rules()
+
+	if entry.canceled {
+		decision.Allowed = false
+		decision.Reason = "robots.txt fetch was canceled"
+		return decision
+	}
+
+	if disallowAll {
+		decision.Allowed = false
+		decision.Reason = "robots.txt is unreachable, host disallowed until it is retried"
+		return decision
+	}
+
+	if robotsTxt == nil {
+		decision.Reason = "no robots.txt, everything allowed"
+		return decision
+	}
+
+	group, rules := robotsTxt.RulesFor(rc.productToken)
+	decision.CrawlDelay = robotsTxt.CrawlDelay
+	if rules == nil {
+		decision.Reason = "no group for this user agent, everything allowed"
+		return decision
+	}
+
+	decision.Group = group
+	decision.Allowed, decision.Rule = rules.Match(MatchTarget(parsedURL))
+	if rules.CrawlDelay > 0 {
+		decision.CrawlDelay = rules.CrawlDelay
+	}
+
+	switch {
+	case decision.Rule == "":
+		decision.Reason = "no rule matched, allowed by default"
+	case decision.Allowed:
+		decision.Reason = "allowed by the longest matching rule"
+	default:
+		decision.Reason = "disallowed by the longest matching rule"
+	}
+	return decision
+}
+
+// HostInfo returns the cached robots.txt state for a host, given as
+// "example.com" or "https://example.com". Without a scheme, https is tried
+// before http. It never fetches.
+func (rc *RobotsChecker) HostInfo(host string) (HostInfo, bool) {
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), "/")
+	domains := []string{host}
+	if !strings.Contains(host, "://") {
+		domains = []string{"https://" + host, "http://" + host}
+	}
+
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+
+	for _, domain := range domains {
+		entry, exists := rc.cache[domain]
+		if !exists {
+			continue
+		}
+
+		info := HostInfo{
+			Host:       domain,
+			Status:     entry.status,
+			StatusCode: entry.statusCode,
+			Error:      entry.err,
+			FetchedAt:  entry.fetchedAt,
+			ExpiresAt:  entry.expiresAt,
+			RobotsTxt:  entry.robotsTxt,
+		}
+		if entry.robotsTxt != nil {
+			info.AppliedGroup, _ = entry.robotsTxt.RulesFor(rc.productToken)
+		}
+		return info, true
+	}
+
+	return HostInfo{}, false
+}
@@ -0,0 +1,134 @@
+package robots
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Match decides whether a target (path plus query, see MatchTarget) is
+// allowed, following RFC 9309: the rule with the longest matching pattern
+// wins, and Allow wins a tie. It also returns the deciding rule, such as
+// "Disallow: /private", or "" when no rule matched and access is allowed by
+// default. /robots.txt itself is always allowed.
+func (rules *UserAgentRules) Match(target string) (bool, string) {
+	target = normalizePercentEncoding(target)
+	if target == "/robots.txt" {
+		return true, ""
+	}
+
+	allowed := true
+	decidingRule := ""
+	longest := -1
+
+	for _, pattern := range rules.Disallow {
+		if len(pattern) > longest && matchesPattern(target, pattern) {
+			allowed = false
+			decidingRule = "Disallow: " + pattern
+			longest = len(pattern)
+		}
+	}
+
+	for _, pattern := range rules.Allow {
+		if len(pattern) >= longest && matchesPattern(target, pattern) {
+			allowed = true
+			decidingRule = "Allow: " + pattern
+			longest = len(pattern)
+		}
+	}
+
+	return allowed, decidingRule
+}
+
+// MatchTarget returns the part of a URL that robots.txt rules are matched
+// against: the escaped path, defaulting to "/", plus the query string.
+func MatchTarget(u *url.URL) string {
+	target := u.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	return target
+}
+
+// matchesPattern reports whether the pattern matches a prefix of the target.
+// "*" matches any sequence of characters and a trailing "$" anchors the
+// pattern to the end of the target.
+func matchesPattern(target, pattern string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(target, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+
+	for i := 1; i < len(parts); i++ {
+		part := parts[i]
+
+		// The last literal of an anchored pattern must end the target
+		if anchored && i == len(parts)-1 {
+			return len(target)-len(part) >= pos && strings.HasSuffix(target, part)
+		}
+
+		idx := strings.Index(target[pos:], part)
+		if idx < 0 {
+			return false
+		}
+		pos += idx + len(part)
+	}
+
+	return !anchored || pos == len(target)
+}
+
+// normalizePercentEncoding brings a path or pattern into the canonical form
+// used for comparison: escapes of unreserved characters are decoded, other
+// escapes use upper case hex, and bytes outside printable ASCII are escaped.
+// This makes "/%7Efoo" match "/~foo" and "/ä" match "/%C3%A4".
+func normalizePercentEncoding(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			decoded := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(decoded) {
+				b.WriteByte(decoded)
+			} else {
+				fmt.Fprintf(&b, "%%%02X", decoded)
+			}
+			i += 2
+			continue
+		}
+		if c <= 0x20 || c >= 0x7f {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
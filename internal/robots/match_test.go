@@ -0,0 +1,217 @@
+package robots
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		allow    []string
+		disallow []string
+		target   string
+		allowed  bool
+		rule     string
+	}{
+		{
+			name:    "no rules",
+			target:  "/page",
+			allowed: true,
+		},
+		{
+			name:     "disallow prefix",
+			disallow: []string{"/private"},
+			target:   "/private/page",
+			allowed:  false,
+			rule:     "Disallow: /private",
+		},
+		{
+			name:     "prefix does not match elsewhere",
+			disallow: []string{"/private"},
+			target:   "/public/private",
+			allowed:  true,
+		},
+		{
+			name:     "longest match allows",
+			allow:    []string{"/private/public"},
+			disallow: []string{"/private"},
+			target:   "/private/public/page",
+			allowed:  true,
+			rule:     "Allow: /private/public",
+		},
+		{
+			name:     "longest match disallows",
+			allow:    []string{"/docs"},
+			disallow: []string{"/docs/drafts"},
+			target:   "/docs/drafts/one",
+			allowed:  false,
+			rule:     "Disallow: /docs/drafts",
+		},
+		{
+			name:     "allow wins a tie",
+			allow:    []string{"/page"},
+			disallow: []string{"/page"},
+			target:   "/page",
+			allowed:  true,
+			rule:     "Allow: /page",
+		},
+		{
+			name:     "allow wins a tie of equal length patterns",
+			allow:    []string{"/a*c"},
+			disallow: []string{"/abc"},
+			target:   "/abc",
+			allowed:  true,
+			rule:     "Allow: /a*c",
+		},
+		{
+			name:     "dollar anchors the end",
+			disallow: []string{"/*.pdf$"},
+			target:   "/files/report.pdf",
+			allowed:  false,
+			rule:     "Disallow: /*.pdf$",
+		},
+		{
+			name:     "dollar does not match a longer path",
+			disallow: []string{"/*.pdf$"},
+			target:   "/files/report.pdf.html",
+			allowed:  true,
+		},
+		{
+			name:     "dollar alone matches the exact path",
+			disallow: []string{"/$"},
+			target:   "/",
+			allowed:  false,
+			rule:     "Disallow: /$",
+		},
+		{
+			name:     "dollar alone does not match below",
+			disallow: []string{"/$"},
+			target:   "/page",
+			allowed:  true,
+		},
+		{
+			name:     "star mid pattern",
+			disallow: []string{"/shop/*/cart"},
+			target:   "/shop/books/cart/view",
+			allowed:  false,
+			rule:     "Disallow: /shop/*/cart",
+		},
+		{
+			name:     "star mid pattern needs the rest",
+			disallow: []string{"/shop/*/cart"},
+			target:   "/shop/books/checkout",
+			allowed:  true,
+		},
+		{
+			name:     "star matches an empty sequence",
+			disallow: []string{"/a*b"},
+			target:   "/ab",
+			allowed:  false,
+			rule:     "Disallow: /a*b",
+		},
+		{
+			name:     "query is matched",
+			disallow: []string{"/search?q="},
+			target:   "/search?q=robots",
+			allowed:  false,
+			rule:     "Disallow: /search?q=",
+		},
+		{
+			name:     "star matches into the query",
+			disallow: []string{"/*?sessionid="},
+			target:   "/cart?sessionid=42",
+			allowed:  false,
+			rule:     "Disallow: /*?sessionid=",
+		},
+		{
+			name:     "other query is allowed",
+			disallow: []string{"/search?q="},
+			target:   "/search?page=2",
+			allowed:  true,
+		},
+		{
+			name:     "escaped unreserved character in target",
+			disallow: []string{"/~joe"},
+			target:   "/%7Ejoe/index.html",
+			allowed:  false,
+			rule:     "Disallow: /~joe",
+		},
+		{
+			name:     "escape case is ignored",
+			disallow: []string{normalizePercentEncoding("/a%2fb")},
+			target:   "/a%2Fb",
+			allowed:  false,
+			rule:     "Disallow: /a%2Fb",
+		},
+		{
+			name:     "unescaped UTF-8 pattern",
+			disallow: []string{normalizePercentEncoding("/ä")},
+			target:   "/%C3%A4",
+			allowed:  false,
+			rule:     "Disallow: /%C3%A4",
+		},
+		{
+			name:     "robots.txt is always allowed",
+			disallow: []string{"/"},
+			target:   "/robots.txt",
+			allowed:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules := &UserAgentRules{Allow: test.allow, Disallow: test.disallow}
+			allowed, rule := rules.Match(test.target)
+			if allowed != test.allowed || rule != test.rule {
+				t.Errorf("Match(%q) = %v, %q, want %v, %q", test.target, allowed, rule, test.allowed, test.rule)
+			}
+		})
+	}
+}
+
+func TestMatchTarget(t *testing.T) {
+	tests := []struct {
+		url    string
+		target string
+	}{
+		{"https://example.com", "/"},
+		{"https://example.com/", "/"},
+		{"https://example.com/a/b", "/a/b"},
+		{"https://example.com/search?q=go&page=2", "/search?q=go&page=2"},
+		{"https://example.com/a%2Fb", "/a%2Fb"},
+		{"https://example.com/page#section", "/page"},
+	}
+
+	for _, test := range tests {
+		u, err := url.Parse(test.url)
+		if err != nil {
+			t.Fatalf("url.Parse(%q): %v", test.url, err)
+		}
+		if target := MatchTarget(u); target != test.target {
+			t.Errorf("MatchTarget(%q) = %q, want %q", test.url, target, test.target)
+		}
+	}
+}
+
+func TestNormalizePercentEncoding(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"/plain", "/plain"},
+		{"/%7Efoo", "/~foo"},
+		{"/%7efoo", "/~foo"},
+		{"/%2f", "/%2F"},
+		{"/%41%42", "/AB"},
+		{"/ä", "/%C3%A4"},
+		{"/a b", "/a%20b"},
+		{"/100%", "/100%"},
+		{"/%zz", "/%zz"},
+	}
+
+	for _, test := range tests {
+		if out := normalizePercentEncoding(test.in); out != test.out {
+			t.Errorf("normalizePercentEncoding(%q) = %q, want %q", test.in, out, test.out)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package robots
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type RobotsTxt struct {
+	UserAgentRules map[string]*UserAgentRules // Keyed by lower case product token
+	CrawlDelay     time.Duration
+	SitemapURLs    []string
+}
+
+type UserAgentRules struct {
+	Allow      []string
+	Disallow   []string
+	CrawlDelay time.Duration
+}
+
+// RulesFor returns the group matching the product token, falling back to
+// the "*" group, along with the group's user agent. It returns nil rules
+// when neither exists.
+func (r *RobotsTxt) RulesFor(productToken string) (string, *UserAgentRules) {
+	group := strings.ToLower(productToken)
+	if rules, exists := r.UserAgentRules[group]; exists {
+		return group, rules
+	}
+	if rules, exists := r.UserAgentRules["*"]; exists {
+		return "*", rules
+	}
+	return "", nil
+}
+
+// Parse reads a robots.txt file as described in RFC 9309.
+//
+// Consecutive user-agent lines form one group sharing the rules that follow
+// them, and groups naming the same product token are merged. Rules before
+// the first user-agent line are ignored. Sitemap lines may appear anywhere.
+// Crawl-delay is not part of the RFC but is honoured when present.
+func Parse(r io.Reader) *RobotsTxt {
+	robotsTxt := &RobotsTxt{
+		UserAgentRules: make(map[string]*UserAgentRules),
+	}
+
+	scanner := bufio.NewScanner(r)
+	var groupAgents []string
+	inRules := false
+	firstLine := true
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if firstLine {
+			line = strings.TrimPrefix(line, "\ufeff")
+			firstLine = false
+		}
+
+		// Strip comments, which may follow a directive on the same line
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		// Split on first colon
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		directive := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		switch directive {
+		case "user-agent":
+			// A user-agent line after rules starts a new group
+			if inRules {
+				groupAgents = nil
+				inRules = false
+			}
+			token := strings.ToLower(ProductToken(value))
+			if token == "" {
+				continue
+			}
+			if _, exists := robotsTxt.UserAgentRules[token]; !exists {
+				robotsTxt.UserAgentRules[token] = &UserAgentRules{
+					Allow:    make([]string, 0),
+					Disallow: make([]string, 0),
+				}
+			}
+			groupAgents = append(groupAgents, token)
+
+		case "allow", "disallow":
+			if len(groupAgents) == 0 {
+				continue
+			}
+			inRules = true
+			// An empty value matches nothing
+			if value == "" {
+				continue
+			}
+			pattern := normalizePercentEncoding(value)
+			for _, agent := range groupAgents {
+				rules := robotsTxt.UserAgentRules[agent]
+				if directive == "allow" {
+					rules.Allow = append(rules.Allow, pattern)
+				} else {
+					rules.Disallow = append(rules.Disallow, pattern)
+				}
+			}
+
+		case "crawl-delay":
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds < 0 {
+				continue
+			}
+			crawlDelay := time.Duration(seconds * float64(time.Second))
+			if len(groupAgents) == 0 {
+				robotsTxt.CrawlDelay = crawlDelay
+				continue
+			}
+			inRules = true
+			for _, agent := range groupAgents {
+				robotsTxt.UserAgentRules[agent].CrawlDelay = crawlDelay
+			}
+
+		case "sitemap":
+			robotsTxt.SitemapURLs = append(robotsTxt.SitemapURLs, value)
+		}
+	}
+
+	return robotsTxt
+}
+
+// ProductToken extracts the product token from a user agent string, e.g.
+// "ExampleBot" from "ExampleBot/1.0 (+https://example.com/bot)". Only the
+// characters allowed by RFC 9309 (letters, "_" and "-") are kept. The
+// wildcard "*" is returned unchanged.
+func ProductToken(userAgent string) string {
+	userAgent = strings.TrimSpace(userAgent)
+	if strings.HasPrefix(userAgent, "*") {
+		return "*"
+	}
+
+	end := 0
+	for end < len(userAgent) {
+		c := userAgent[end]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c == '-' {
+			end++
+			continue
+		}
+		break
+	}
+	return userAgent[:end]
+}
@@ -0,0 +1,168 @@
+package robots
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseGroups(t *testing.T) {
+	tests := []struct {
+		name     string
+		robots   string
+		token    string
+		group    string
+		allow    []string
+		disallow []string
+	}{
+		{
+			name:     "wildcard group",
+			robots:   "User-agent: *\nDisallow: /private\n",
+			token:    "ExampleBot",
+			group:    "*",
+			disallow: []string{"/private"},
+		},
+		{
+			name:     "specific group wins over wildcard",
+			robots:   "User-agent: *\nDisallow: /\n\nUser-agent: ExampleBot\nDisallow: /private\n",
+			token:    "ExampleBot",
+			group:    "examplebot",
+			disallow: []string{"/private"},
+		},
+		{
+			name:     "product tokens are case-insensitive",
+			robots:   "User-agent: EXAMPLEBOT\nDisallow: /private\n",
+			token:    "examplebot",
+			group:    "examplebot",
+			disallow: []string{"/private"},
+		},
+		{
+			name:     "version in user-agent line is ignored",
+			robots:   "User-agent: ExampleBot/2.1\nDisallow: /private\n",
+			token:    "ExampleBot",
+			group:    "examplebot",
+			disallow: []string{"/private"},
+		},
+		{
+			name:     "consecutive user-agent lines share a group",
+			robots:   "User-agent: OtherBot\nUser-agent: ExampleBot\nDisallow: /shared\n",
+			token:    "ExampleBot",
+			group:    "examplebot",
+			disallow: []string{"/shared"},
+		},
+		{
+			name:     "groups of the same token are merged",
+			robots:   "User-agent: ExampleBot\nDisallow: /a\n\nUser-agent: OtherBot\nDisallow: /b\n\nUser-agent: examplebot\nAllow: /a/public\nDisallow: /c\n",
+			token:    "ExampleBot",
+			group:    "examplebot",
+			allow:    []string{"/a/public"},
+			disallow: []string{"/a", "/c"},
+		},
+		{
+			name:     "user-agent after rules starts a new group",
+			robots:   "User-agent: ExampleBot\nDisallow: /a\nUser-agent: OtherBot\nDisallow: /b\n",
+			token:    "ExampleBot",
+			group:    "examplebot",
+			disallow: []string{"/a"},
+		},
+		{
+			name:     "rules before any user-agent are ignored",
+			robots:   "Disallow: /orphan\nUser-agent: *\nDisallow: /private\n",
+			token:    "ExampleBot",
+			group:    "*",
+			disallow: []string{"/private"},
+		},
+		{
+			name:     "directives are case-insensitive and comments stripped",
+			robots:   "# comment\nUSER-AGENT: * # everyone\nDISALLOW: /private # keep out\nallow: /private/ok\n",
+			token:    "ExampleBot",
+			group:    "*",
+			allow:    []string{"/private/ok"},
+			disallow: []string{"/private"},
+		},
+		{
+			name:   "empty disallow matches nothing",
+			robots: "User-agent: *\nDisallow:\n",
+			token:  "ExampleBot",
+			group:  "*",
+		},
+		{
+			name:     "byte order mark is skipped",
+			robots:   "\ufeffUser-agent: *\nDisallow: /private\n",
+			token:    "ExampleBot",
+			group:    "*",
+			disallow: []string{"/private"},
+		},
+		{
+			name:     "patterns are normalized",
+			robots:   "User-agent: *\nDisallow: /%7ejoe\nDisallow: /ä\n",
+			token:    "ExampleBot",
+			group:    "*",
+			disallow: []string{"/~joe", "/%C3%A4"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			robotsTxt := Parse(strings.NewReader(test.robots))
+			group, rules := robotsTxt.RulesFor(test.token)
+			if group != test.group {
+				t.Fatalf("RulesFor(%q) group = %q, want %q", test.token, group, test.group)
+			}
+			if !slices.Equal(rules.Allow, test.allow) {
+				t.Errorf("Allow = %q, want %q", rules.Allow, test.allow)
+			}
+			if !slices.Equal(rules.Disallow, test.disallow) {
+				t.Errorf("Disallow = %q, want %q", rules.Disallow, test.disallow)
+			}
+		})
+	}
+}
+
+func TestParseNoGroup(t *testing.T) {
+	robotsTxt := Parse(strings.NewReader("User-agent: OtherBot\nDisallow: /\n"))
+	if group, rules := robotsTxt.RulesFor("ExampleBot"); group != "" || rules != nil {
+		t.Errorf("RulesFor = %q, %v, want no group", group, rules)
+	}
+}
+
+func TestParseCrawlDelayAndSitemaps(t *testing.T) {
+	robotsTxt := Parse(strings.NewReader(`Sitemap: https://example.com/a.xml
+Crawl-delay: 3
+User-agent: ExampleBot
+Crawl-delay: 1.5
+Disallow: /private
+Sitemap: https://example.com/b.xml
+`))
+
+	if robotsTxt.CrawlDelay != 3*time.Second {
+		t.Errorf("CrawlDelay = %s, want 3s", robotsTxt.CrawlDelay)
+	}
+	if _, rules := robotsTxt.RulesFor("ExampleBot"); rules.CrawlDelay != 1500*time.Millisecond {
+		t.Errorf("group CrawlDelay = %s, want 1.5s", rules.CrawlDelay)
+	}
+	want := []string{"https://example.com/a.xml", "https://example.com/b.xml"}
+	if !slices.Equal(robotsTxt.SitemapURLs, want) {
+		t.Errorf("SitemapURLs = %q, want %q", robotsTxt.SitemapURLs, want)
+	}
+}
+
+func TestProductToken(t *testing.T) {
+	tests := []struct {
+		userAgent, token string
+	}{
+		{"ExampleBot", "ExampleBot"},
+		{"ExampleBot/1.0 (+https://example.com/bot)", "ExampleBot"},
+		{"  Example_Bot-2 ", "Example_Bot-"},
+		{"*", "*"},
+		{"Mozilla/5.0 (compatible; ExampleBot/1.0)", "Mozilla"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if token := ProductToken(test.userAgent); token != test.token {
+			t.Errorf("ProductToken(%q) = %q, want %q", test.userAgent, token, test.token)
+		}
+	}
+}
@@ -1,210 +1,274 @@
 package robots
 
 import (
-	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// maxRobotsTxtBytes is how much of a robots.txt file is parsed. RFC 9309
+	// requires at least 500 KiB; anything after that is ignored.
+	maxRobotsTxtBytes = 500 * 1024
+
+	DefaultCacheTTL      = 24 * time.Hour
+	DefaultRetryInterval = 5 * time.Minute
+)
+
+// FetchStatus describes the outcome of the last robots.txt fetch for a host.
+type FetchStatus string
+
+const (
+	StatusOK          FetchStatus = "ok"          // Parsed, rules apply
+	StatusUnavailable FetchStatus = "unavailable" // 4xx or too many redirects, everything allowed
+	StatusUnreachable FetchStatus = "unreachable" // 5xx, 429 or network error, everything disallowed until retried
 )
 
-type RobotsTxt struct {
-	UserAgentRules map[string]*UserAgentRules
-	CrawlDelay     time.Duration
-	SitemapURLs    []string
+// cacheEntry is the cached robots.txt state of one host.
+type cacheEntry struct {
+	robotsTxt  *RobotsTxt // nil unless the last successful fetch was parsed
+	status     FetchStatus
+	statusCode int
+	err        string
+	fetchedAt  time.Time
+	expiresAt  time.Time
+	canceled   bool // The fetch was aborted, so the entry was not cached
+}
+
+// rules returns the robots.txt to apply, or disallowAll while the host is
+// unreachable. An unreachable host keeps using its last good robots.txt.
+func (e *cacheEntry) rules() (robotsTxt *RobotsTxt, disallowAll bool) {
+	if e.status == StatusUnreachable && e.robotsTxt == nil {
+		return nil, true
+	}
+	return e.robotsTxt, false
 }
 
-type UserAgentRules struct {
-	Allow      []string
-	Disallow   []string
-	CrawlDelay time.Duration
+// CacheStats summarizes the robots.txt cache.
+type CacheStats struct {
+	Hosts       int `json:"hosts"`
+	OK          int `json:"ok"`
+	Unavailable int `json:"unavailable"`
+	Unreachable int `json:"unreachable"`
+	Hits        int `json:"hits"`
+	Misses      int `json:"misses"`
+	Refreshes   int `json:"refreshes"` // Fetches of hosts whose entry had expired
+	Fetches     int `json:"fetches"`
+	Errors      int `json:"errors"`    // Fetches ending in a 5xx, 429 or network error
+	Coalesced   int `json:"coalesced"` // Lookups that waited on another goroutine's fetch
+}
+
+// Fetcher performs the HTTP requests for robots.txt files, so they carry the
+// same user agent as page fetches. A redirect response returned as is counts
+// as unavailable. Canceling ctx aborts a request.
+type Fetcher interface {
+	Get(ctx context.Context, url string) (*http.Response, error)
+	UserAgent() string
 }
 
 type RobotsChecker struct {
-	cache     map[string]*RobotsTxt
-	mu        sync.RWMutex
-	userAgent string
+	cache         map[string]*cacheEntry
+	mu            sync.RWMutex
+	inFlight      singleflight.Group // One fetch per host at a time
+	fetcher       Fetcher
+	productToken  string
+	cacheTTL      time.Duration
+	retryInterval time.Duration
+	stats         CacheStats
 }
 
-func NewRobotsChecker(userAgent string) *RobotsChecker {
-	if userAgent == "" {
-		userAgent = "*"
+func NewRobotsChecker(fetcher Fetcher) *RobotsChecker {
+	productToken := ProductToken(fetcher.UserAgent())
+	if productToken == "" {
+		productToken = "*"
 	}
 	return &RobotsChecker{
-		cache:     make(map[string]*RobotsTxt),
-		userAgent: userAgent,
+		cache:         make(map[string]*cacheEntry),
+		fetcher:       fetcher,
+		productToken:  productToken,
+		cacheTTL:      DefaultCacheTTL,
+		retryInterval: DefaultRetryInterval,
 	}
 }
 
-func (rc *RobotsChecker) IsAllowed(targetURL string) (bool, time.Duration) {
-	parsedURL, err := url.Parse(targetURL)
-	if err != nil {
-		return true, 0 // If we can't parse the URL, allow it
-	}
+// SetExpiry sets how long a fetched robots.txt is cached, and how long to
+// wait before retrying a host whose robots.txt was unreachable.
+func (rc *RobotsChecker) SetExpiry(cacheTTL, retryInterval time.Duration) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.cacheTTL = cacheTTL
+	rc.retryInterval = retryInterval
+}
 
-	domain := parsedURL.Scheme + "://" + parsedURL.Host
-	robotsTxt := rc.getRobotsTxt(domain)
+func (rc *RobotsChecker) IsAllowed(ctx context.Context, targetURL string) (bool, time.Duration) {
+	decision := rc.Check(ctx, targetURL)
+	return decision.Allowed, decision.CrawlDelay
+}
 
-	if robotsTxt == nil {
-		return true, 0 // If no robots.txt or error fetching, allow crawling
+// getRobotsTxt returns the cached robots.txt state of the domain, fetching
+// it if needed. If ctx is done during the fetch, the host is reported as
+// unreachable without caching that.
+func (rc *RobotsChecker) getRobotsTxt(ctx context.Context, domain string) *cacheEntry {
+	domain = strings.ToLower(domain)
+	if entry, fresh := rc.cached(domain); fresh {
+		rc.mu.Lock()
+		rc.stats.Hits++
+		rc.mu.Unlock()
+		return entry
 	}
 
-	// Check user agent specific rules first, then fall back to *
-	userAgents := []string{rc.userAgent, "*"}
-	for _, ua := range userAgents {
-		if rules, exists := robotsTxt.UserAgentRules[ua]; exists {
-			allowed := rc.checkRules(parsedURL.Path, rules)
-			crawlDelay := rules.CrawlDelay
-			if crawlDelay == 0 {
-				crawlDelay = robotsTxt.CrawlDelay
-			}
-			return allowed, crawlDelay
+	for {
+		entry := rc.fetchOnce(ctx, domain)
+		// Another lookup's fetch was canceled, so fetch again
+		if entry.canceled && ctx.Err() == nil {
+			continue
 		}
+		return entry
 	}
-
-	return true, robotsTxt.CrawlDelay
 }
 
-func (rc *RobotsChecker) getRobotsTxt(domain string) *RobotsTxt {
-	rc.mu.RLock()
-	if robotsTxt, exists := rc.cache[domain]; exists {
-		rc.mu.RUnlock()
-		return robotsTxt
-	}
-	rc.mu.RUnlock()
+// fetchOnce fetches the domain's robots.txt unless the cache was filled
+// meanwhile. Concurrent lookups for the same host share a single fetch.
+func (rc *RobotsChecker) fetchOnce(ctx context.Context, domain string) *cacheEntry {
+	result, _, shared := rc.inFlight.Do(domain, func() (interface{}, error) {
+		// Another flight may have filled the cache since the check above
+		entry, fresh := rc.cached(domain)
+		if fresh {
+			return entry, nil
+		}
 
-	// Fetch and parse robots.txt
-	robotsTxt := rc.fetchAndParseRobotsTxt(domain)
+		// Fetch and parse robots.txt
+		fetched := rc.fetchAndParseRobotsTxt(ctx, domain)
+		if ctx.Err() != nil {
+			fetched.status = StatusUnreachable
+			fetched.canceled = true
+			return fetched, nil
+		}
 
-	rc.mu.Lock()
-	rc.cache[domain] = robotsTxt
-	rc.mu.Unlock()
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
 
-	return robotsTxt
-}
+		rc.stats.Misses++
+		rc.stats.Fetches++
+		if entry != nil {
+			rc.stats.Refreshes++
+		}
 
-func (rc *RobotsChecker) fetchAndParseRobotsTxt(domain string) *RobotsTxt {
-	robotsURL := domain + "/robots.txt"
+		switch fetched.status {
+		case StatusOK, StatusUnavailable:
+			fetched.expiresAt = fetched.fetchedAt.Add(rc.cacheTTL)
+		case StatusUnreachable:
+			rc.stats.Errors++
+			fetched.expiresAt = fetched.fetchedAt.Add(rc.retryInterval)
+			// Keep using the last good copy while the host is unreachable
+			if entry != nil && entry.robotsTxt != nil {
+				fetched.robotsTxt = entry.robotsTxt
+			}
+		}
 
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
+		rc.cache[domain] = fetched
+		return fetched, nil
+	})
 
-	resp, err := client.Get(robotsURL)
-	if err != nil {
-		fmt.Printf("Error fetching robots.txt for %s: %v\n", domain, err)
-		return nil
+	if shared {
+		rc.mu.Lock()
+		rc.stats.Coalesced++
+		rc.mu.Unlock()
 	}
-	defer resp.Body.Close()
+	return result.(*cacheEntry)
+}
 
-	if resp.StatusCode != 200 {
-		fmt.Printf("robots.txt not found for %s (status: %d)\n", domain, resp.StatusCode)
-		return nil
-	}
+// cached returns the cache entry for the domain, if any, and whether it is
+// still fresh.
+func (rc *RobotsChecker) cached(domain string) (*cacheEntry, bool) {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
 
-	robotsTxt := &RobotsTxt{
-		UserAgentRules: make(map[string]*UserAgentRules),
+	entry, exists := rc.cache[domain]
+	if !exists {
+		return nil, false
 	}
+	return entry, time.Now().Before(entry.expiresAt)
+}
 
-	scanner := bufio.NewScanner(resp.Body)
-	var currentUserAgent string
-	var currentRules *UserAgentRules
-
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-
-		// Skip comments and empty lines
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		// Split on first colon
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) != 2 {
-			continue
-		}
+func (rc *RobotsChecker) fetchAndParseRobotsTxt(ctx context.Context, domain string) *cacheEntry {
+	robotsURL := domain + "/robots.txt"
+	entry := &cacheEntry{fetchedAt: time.Now()}
 
-		directive := strings.ToLower(strings.TrimSpace(parts[0]))
-		value := strings.TrimSpace(parts[1])
-
-		switch directive {
-		case "user-agent":
-			currentUserAgent = strings.ToLower(value)
-			if _, exists := robotsTxt.UserAgentRules[currentUserAgent]; !exists {
-				robotsTxt.UserAgentRules[currentUserAgent] = &UserAgentRules{
-					Allow:    make([]string, 0),
-					Disallow: make([]string, 0),
-				}
-			}
-			currentRules = robotsTxt.UserAgentRules[currentUserAgent]
+	resp, err := rc.fetcher.Get(ctx, robotsURL)
+	if ctx.Err() != nil {
+		return entry
+	}
+	if err != nil {
+		fmt.Printf("Error fetching robots.txt for %s: %v\n", domain, err)
+		entry.status = StatusUnreachable
+		entry.err = err.Error()
+		return entry
+	}
+	defer resp.Body.Close()
 
-		case "allow":
-			if currentRules != nil && value != "" {
-				currentRules.Allow = append(currentRules.Allow, value)
-			}
+	entry.statusCode = resp.StatusCode
 
-		case "disallow":
-			if currentRules != nil {
-				currentRules.Disallow = append(currentRules.Disallow, value)
-			}
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		entry.status = StatusOK
+		entry.robotsTxt = Parse(io.LimitReader(resp.Body, maxRobotsTxtBytes))
 
-		case "crawl-delay":
-			if delay, err := strconv.Atoi(value); err == nil {
-				crawlDelay := time.Duration(delay) * time.Second
-				if currentRules != nil {
-					currentRules.CrawlDelay = crawlDelay
-				} else {
-					robotsTxt.CrawlDelay = crawlDelay
-				}
-			}
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		fmt.Printf("robots.txt unreachable for %s (status: %d), disallowing until retry\n", domain, resp.StatusCode)
+		entry.status = StatusUnreachable
 
-		case "sitemap":
-			robotsTxt.SitemapURLs = append(robotsTxt.SitemapURLs, value)
-		}
+	default:
+		fmt.Printf("robots.txt not found for %s (status: %d)\n", domain, resp.StatusCode)
+		entry.status = StatusUnavailable
 	}
 
-	return robotsTxt
+	return entry
 }
 
-func (rc *RobotsChecker) checkRules(path string, rules *UserAgentRules) bool {
-	// Check Allow rules first (more specific)
-	for _, allowPattern := range rules.Allow {
-		if rc.matchesPattern(path, allowPattern) {
-			return true
-		}
-	}
-
-	// Check Disallow rules
-	for _, disallowPattern := range rules.Disallow {
-		if rc.matchesPattern(path, disallowPattern) {
-			return false
+// CacheStats returns a snapshot of the robots.txt cache counters.
+func (rc *RobotsChecker) CacheStats() CacheStats {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+
+	stats := rc.stats
+	stats.Hosts = len(rc.cache)
+	for _, entry := range rc.cache {
+		switch entry.status {
+		case StatusOK:
+			stats.OK++
+		case StatusUnavailable:
+			stats.Unavailable++
+		case StatusUnreachable:
+			stats.Unreachable++
 		}
 	}
-
-	// If no rules match, allow by default
-	return true
+	return stats
 }
 
-func (rc *RobotsChecker) matchesPattern(path, pattern string) bool {
-	if pattern == "" {
-		return false
+// Sitemaps returns the sitemap URLs listed in robots.txt for the URL's host
+func (rc *RobotsChecker) Sitemaps(ctx context.Context, targetURL string) []string {
+	parsedURL, err := url.Parse(targetURL)
+	if err != nil {
+		return nil
 	}
 
-	// Handle wildcard at the end
-	if strings.HasSuffix(pattern, "*") {
-		prefix := pattern[:len(pattern)-1]
-		return strings.HasPrefix(path, prefix)
+	robotsTxt, _ := rc.getRobotsTxt(ctx, parsedURL.Scheme+"://"+parsedURL.Host).rules()
+	if robotsTxt == nil {
+		return nil
 	}
-
-	// Exact match or prefix match
-	return path == pattern || strings.HasPrefix(path, pattern)
+	return robotsTxt.SitemapURLs
 }
 
 // GetCrawlDelay returns the crawl delay for a specific URL
-func (rc *RobotsChecker) GetCrawlDelay(targetURL string) time.Duration {
-	_, delay := rc.IsAllowed(targetURL)
+func (rc *RobotsChecker) GetCrawlDelay(ctx context.Context, targetURL string) time.Duration {
+	_, delay := rc.IsAllowed(ctx, targetURL)
 	return delay
 }
@@ -0,0 +1,161 @@
+package robots
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// fakeFetcher answers every robots.txt request with the same response.
+type fakeFetcher struct {
+	status int
+	body   string
+	err    error
+	calls  int
+}
+
+func (f *fakeFetcher) Get(ctx context.Context, url string) (*http.Response, error) {
+	f.calls++
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &http.Response{
+		StatusCode: f.status,
+		Body:       io.NopCloser(strings.NewReader(f.body)),
+	}, nil
+}
+
+func (f *fakeFetcher) UserAgent() string {
+	return "ExampleBot/1.0 (+https://example.com/bot)"
+}
+
+func TestCheckFetchStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		fetcher *fakeFetcher
+		url     string
+		allowed bool
+		status  FetchStatus
+	}{
+		{
+			name:    "2xx rules apply",
+			fetcher: &fakeFetcher{status: http.StatusOK, body: "User-agent: *\nDisallow: /private\n"},
+			url:     "https://example.com/private/page",
+			allowed: false,
+			status:  StatusOK,
+		},
+		{
+			name:    "2xx allows unmatched paths",
+			fetcher: &fakeFetcher{status: http.StatusOK, body: "User-agent: *\nDisallow: /private\n"},
+			url:     "https://example.com/public",
+			allowed: true,
+			status:  StatusOK,
+		},
+		{
+			name:    "2xx follows the crawler's own group",
+			fetcher: &fakeFetcher{status: http.StatusOK, body: "User-agent: *\nDisallow: /\n\nuser-agent: examplebot\nAllow: /\n"},
+			url:     "https://example.com/page",
+			allowed: true,
+			status:  StatusOK,
+		},
+		{
+			name:    "404 allows everything",
+			fetcher: &fakeFetcher{status: http.StatusNotFound},
+			url:     "https://example.com/private/page",
+			allowed: true,
+			status:  StatusUnavailable,
+		},
+		{
+			name:    "403 allows everything",
+			fetcher: &fakeFetcher{status: http.StatusForbidden},
+			url:     "https://example.com/page",
+			allowed: true,
+			status:  StatusUnavailable,
+		},
+		{
+			name:    "redirect returned as is allows everything",
+			fetcher: &fakeFetcher{status: http.StatusMovedPermanently},
+			url:     "https://example.com/page",
+			allowed: true,
+			status:  StatusUnavailable,
+		},
+		{
+			name:    "500 disallows everything",
+			fetcher: &fakeFetcher{status: http.StatusInternalServerError},
+			url:     "https://example.com/page",
+			allowed: false,
+			status:  StatusUnreachable,
+		},
+		{
+			name:    "503 disallows everything",
+			fetcher: &fakeFetcher{status: http.StatusServiceUnavailable},
+			url:     "https://example.com/page",
+			allowed: false,
+			status:  StatusUnreachable,
+		},
+		{
+			name:    "429 disallows everything",
+			fetcher: &fakeFetcher{status: http.StatusTooManyRequests},
+			url:     "https://example.com/page",
+			allowed: false,
+			status:  StatusUnreachable,
+		},
+		{
+			name:    "network error disallows everything",
+			fetcher: &fakeFetcher{err: errors.New("connection refused")},
+			url:     "https://example.com/page",
+			allowed: false,
+			status:  StatusUnreachable,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checker := NewRobotsChecker(test.fetcher)
+			decision := checker.Check(context.Background(), test.url)
+			if decision.Allowed != test.allowed || decision.Status != test.status {
+				t.Errorf("Check(%q) = allowed %v, status %q, want %v, %q", test.url, decision.Allowed, decision.Status, test.allowed, test.status)
+			}
+		})
+	}
+}
+
+func TestCheckCachesRobotsTxt(t *testing.T) {
+	fetcher := &fakeFetcher{status: http.StatusOK, body: "User-agent: *\nDisallow: /private\n"}
+	checker := NewRobotsChecker(fetcher)
+
+	checker.Check(context.Background(), "https://example.com/a")
+	checker.Check(context.Background(), "https://EXAMPLE.com/b")
+	if fetcher.calls != 1 {
+		t.Errorf("fetched robots.txt %d times, want 1", fetcher.calls)
+	}
+
+	checker.Check(context.Background(), "http://example.com/a")
+	if fetcher.calls != 2 {
+		t.Errorf("fetched robots.txt %d times after a scheme change, want 2", fetcher.calls)
+	}
+}
+
+func TestCheckCanceledIsNotCached(t *testing.T) {
+	fetcher := &fakeFetcher{status: http.StatusOK, body: "User-agent: *\nDisallow: /private\n"}
+	checker := NewRobotsChecker(fetcher)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if decision := checker.Check(ctx, "https://example.com/page"); decision.Allowed {
+		t.Errorf("Check with a canceled context allowed the URL")
+	}
+	if stats := checker.CacheStats(); stats.Hosts != 0 {
+		t.Errorf("canceled fetch was cached for %d hosts", stats.Hosts)
+	}
+
+	if decision := checker.Check(context.Background(), "https://example.com/page"); !decision.Allowed || decision.Status != StatusOK {
+		t.Errorf("Check after a canceled fetch = allowed %v, status %q, want true, %q", decision.Allowed, decision.Status, StatusOK)
+	}
+}
@@ -0,0 +1,248 @@
+package scope
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Mode controls which hosts are in scope relative to the seed URLs.
+type Mode string
+
+const (
+	ModeAny        Mode = "any"         // Any host
+	ModeSameHost   Mode = "same-host"   // Exactly the seed hosts
+	ModeSameDomain Mode = "same-domain" // Hosts sharing a registrable domain with a seed
+	ModeList       Mode = "list"        // Only hosts in AllowDomains
+)
+
+// Config describes the scope of a single crawl.
+type Config struct {
+	Mode         Mode     `json:"mode"`
+	AllowDomains []string `json:"allowDomains,omitempty"` // Always in scope unless denied, subdomains included
+	DenyDomains  []string `json:"denyDomains,omitempty"`  // Never in scope, subdomains included
+	Include      []string `json:"include,omitempty"`      // If set, path and query must match one of these
+	Exclude      []string `json:"exclude,omitempty"`      // Path and query must not match any of these
+}
+
+// Scope decides whether a discovered URL belongs to the crawl.
+type Scope struct {
+	mode         Mode
+	seedHosts    map[string]bool
+	seedDomains  map[string]bool
+	allowDomains []string
+	denyDomains  []string
+	include      []*regexp.Regexp
+	exclude      []*regexp.Regexp
+	mu           sync.RWMutex // Guards the seed hosts, which grow as seeds are added
+}
+
+// New builds a scope for a crawl starting at the given seeds.
+//
+// Include and exclude patterns are globs where * matches any run of
+// characters, or regular expressions when prefixed with "re:". They are
+// matched against the URL path plus query, e.g. "/search?q=go".
+func New(cfg Config, seeds []string) (*Scope, error) {
+	mode := cfg.Mode
+	if mode == "" {
+		mode = ModeAny
+	}
+
+	switch mode {
+	case ModeAny, ModeSameHost, ModeSameDomain, ModeList:
+	default:
+		return nil, fmt.Errorf("unknown scope mode %q", mode)
+	}
+
+	s := &Scope{
+		mode:         mode,
+		seedHosts:    make(map[string]bool),
+		seedDomains:  make(map[string]bool),
+		allowDomains: normalizeDomains(cfg.AllowDomains),
+		denyDomains:  normalizeDomains(cfg.DenyDomains),
+	}
+
+	if err := s.AddSeeds(seeds); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if s.include, err = compilePatterns(cfg.Include); err != nil {
+		return nil, err
+	}
+	if s.exclude, err = compilePatterns(cfg.Exclude); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// AddSeeds extends the scope with seeds added to a running crawl.
+func (s *Scope) AddSeeds(seeds []string) error {
+	hosts := make([]string, 0, len(seeds))
+	for _, seed := range seeds {
+		parsedURL, err := url.Parse(seed)
+		if err != nil {
+			return fmt.Errorf("invalid seed URL %q: %w", seed, err)
+		}
+		hosts = append(hosts, strings.ToLower(parsedURL.Hostname()))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, host := range hosts {
+		s.seedHosts[host] = true
+		s.seedDomains[registrableDomain(host)] = true
+	}
+	return nil
+}
+
+// Allows reports whether the URL is in scope, and if not, why.
+func (s *Scope) Allows(rawURL string) (bool, string) {
+	return s.allows(rawURL, s.mode, s.hostAllowed)
+}
+
+// AllowsFrom is Allows for a URL reached from a seed with a scope mode of
+// its own, which replaces the crawl's mode relative to the seed's host.
+// Allowed and denied domains and the path rules still apply.
+func (s *Scope) AllowsFrom(rawURL string, mode Mode, seedHost string) (bool, string) {
+	seedHost = strings.ToLower(seedHost)
+	return s.allows(rawURL, mode, func(host string) bool {
+		if matchesDomain(host, s.allowDomains) {
+			return true
+		}
+		switch mode {
+		case ModeAny:
+			return true
+		case ModeSameHost:
+			return host == seedHost
+		case ModeSameDomain:
+			return registrableDomain(host) == registrableDomain(seedHost)
+		default:
+			return false
+		}
+	})
+}
+
+func (s *Scope) allows(rawURL string, mode Mode, hostAllowed func(string) bool) (bool, string) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return false, "unparseable URL"
+	}
+
+	host := strings.ToLower(parsedURL.Hostname())
+	if matchesDomain(host, s.denyDomains) {
+		return false, "host is on the deny list"
+	}
+
+	if !hostAllowed(host) {
+		return false, fmt.Sprintf("host is outside %s scope", mode)
+	}
+
+	target := parsedURL.EscapedPath()
+	if parsedURL.RawQuery != "" {
+		target += "?" + parsedURL.RawQuery
+	}
+
+	if len(s.include) > 0 && !matchesAny(target, s.include) {
+		return false, "path does not match any include rule"
+	}
+
+	if matchesAny(target, s.exclude) {
+		return false, "path matches an exclude rule"
+	}
+
+	return true, ""
+}
+
+func (s *Scope) hostAllowed(host string) bool {
+	if matchesDomain(host, s.allowDomains) {
+		return true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	switch s.mode {
+	case ModeAny:
+		return true
+	case ModeSameHost:
+		return s.seedHosts[host]
+	case ModeSameDomain:
+		return s.seedDomains[registrableDomain(host)]
+	default:
+		return false
+	}
+}
+
+// registrableDomain returns the public suffix plus one label, e.g.
+// "example.co.uk" for "www.example.co.uk". Hosts without a public suffix,
+// such as IP addresses or localhost, are returned unchanged.
+func registrableDomain(host string) string {
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+func matchesDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(target string, patterns []*regexp.Regexp) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(target) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeDomains(domains []string) []string {
+	result := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		domain = strings.Trim(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if domain != "" {
+			result = append(result, domain)
+		}
+	}
+	return result
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		var expr string
+		if strings.HasPrefix(pattern, "re:") {
+			expr = strings.TrimPrefix(pattern, "re:")
+		} else {
+			expr = globToRegexp(pattern)
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scope pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// globToRegexp anchors the glob to the whole target and turns * into .*.
+func globToRegexp(glob string) string {
+	parts := strings.Split(glob, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return "^" + strings.Join(parts, ".*") + "$"
+}
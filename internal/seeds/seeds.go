@@ -0,0 +1,251 @@
+// Package seeds reads, validates and normalizes the URLs crawls start from.
+package seeds
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"webcrawler/internal/scope"
+)
+
+// validHost matches host names: dot separated labels of letters, digits,
+// '-' and '_' that don't start or end with '-'.
+var validHost = regexp.MustCompile(`^([a-z0-9_]([a-z0-9_-]*[a-z0-9_])?\.)*[a-z0-9_]([a-z0-9_-]*[a-z0-9_])?\.?$`)
+
+// Seed is a URL a crawl starts from. Its depth and scope, when set, apply
+// to every page reached from it instead of the crawl's.
+type Seed struct {
+	URL      string     `json:"url"`
+	MaxDepth int        `json:"maxDepth,omitempty"` // 0 keeps the crawl's depth limits
+	Scope    scope.Mode `json:"scope,omitempty"`    // Empty keeps the crawl's scope mode
+}
+
+// UnmarshalJSON accepts a plain URL string as well as an object.
+func (s *Seed) UnmarshalJSON(data []byte) error {
+	var rawURL string
+	if err := json.Unmarshal(data, &rawURL); err == nil {
+		*s = Seed{URL: rawURL}
+		return nil
+	}
+
+	type plain Seed
+	return json.Unmarshal(data, (*plain)(s))
+}
+
+// MarshalJSON writes seeds without options as plain URL strings.
+func (s Seed) MarshalJSON() ([]byte, error) {
+	if s.MaxDepth == 0 && s.Scope == "" {
+		return json.Marshal(s.URL)
+	}
+
+	type plain Seed
+	return json.Marshal(plain(s))
+}
+
+// FromURLs returns seeds without options of their own.
+func FromURLs(urls []string) []Seed {
+	result := make([]Seed, len(urls))
+	for i, u := range urls {
+		result[i] = Seed{URL: u}
+	}
+	return result
+}
+
+// URLs returns the seeds' URLs.
+func URLs(list []Seed) []string {
+	result := make([]string, len(list))
+	for i, seed := range list {
+		result[i] = seed.URL
+	}
+	return result
+}
+
+// NormalizeURL checks that a seed is an absolute http or https URL and
+// returns it in canonical form: lowercase scheme and host, no default port,
+// no fragment, and "/" for an empty path. URLs without a scheme get https.
+func NormalizeURL(rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return "", errors.New("empty seed URL")
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid seed URL %q: %w", rawURL, err)
+	}
+	parsedURL.Scheme = strings.ToLower(parsedURL.Scheme)
+	if (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Hostname() == "" {
+		return "", fmt.Errorf("invalid seed URL %q: must be an absolute http or https URL", rawURL)
+	}
+
+	host := strings.ToLower(parsedURL.Hostname())
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		host = "[" + host + "]"
+	} else if !validHost.MatchString(host) {
+		return "", fmt.Errorf("invalid seed URL %q: invalid host %q", rawURL, host)
+	}
+	if port := parsedURL.Port(); port != "" && !(parsedURL.Scheme == "http" && port == "80") && !(parsedURL.Scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+	parsedURL.Host = host
+	parsedURL.Fragment = ""
+	parsedURL.RawFragment = ""
+	if parsedURL.Path == "" {
+		parsedURL.Path = "/"
+	}
+	return parsedURL.String(), nil
+}
+
+// Normalize normalizes the seeds' URLs, checks their options and drops
+// duplicates, keeping the first. The error lists every invalid seed.
+func Normalize(list []Seed) ([]Seed, error) {
+	var errs []string
+	seen := make(map[string]bool, len(list))
+	result := make([]Seed, 0, len(list))
+	for _, seed := range list {
+		normalized, err := Check(seed)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if seen[normalized.URL] {
+			continue
+		}
+		seen[normalized.URL] = true
+		result = append(result, normalized)
+	}
+
+	if len(errs) > 0 {
+		return result, errors.New(strings.Join(errs, "; "))
+	}
+	return result, nil
+}
+
+// Check validates a single seed and returns it with its URL normalized.
+func Check(seed Seed) (Seed, error) {
+	normalized, err := NormalizeURL(seed.URL)
+	if err != nil {
+		return Seed{}, err
+	}
+	seed.URL = normalized
+
+	if seed.MaxDepth < 0 {
+		return Seed{}, fmt.Errorf("seed %s: depth must not be negative, got %d", seed.URL, seed.MaxDepth)
+	}
+	switch seed.Scope {
+	case "", scope.ModeAny, scope.ModeSameHost, scope.ModeSameDomain:
+	default:
+		return Seed{}, fmt.Errorf("seed %s: scope must be %s, %s or %s, got %q", seed.URL, scope.ModeAny, scope.ModeSameHost, scope.ModeSameDomain, seed.Scope)
+	}
+	return seed, nil
+}
+
+// ReadFile reads seeds from a file, or from stdin if path is "-". See Read
+// for the format; files ending in .csv are always read as CSV.
+func ReadFile(path string) ([]Seed, error) {
+	if path == "-" {
+		return Read(os.Stdin, "stdin", false)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading seed file: %w", err)
+	}
+	defer f.Close()
+	return Read(f, path, strings.EqualFold(filepath.Ext(path), ".csv"))
+}
+
+// Read parses one seed URL per line, skipping blank lines and lines
+// starting with #. Input whose first line is a "url,depth,scope" header,
+// or any input when isCSV is set, is read as CSV with optional depth and
+// scope columns in that order. Seeds are not normalized; name is used in
+// error messages. Rows that can't be parsed are reported in the error,
+// and the other seeds are still returned.
+func Read(r io.Reader, name string, isCSV bool) ([]Seed, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+
+	text := string(data)
+	if !isCSV {
+		first := strings.TrimSpace(strings.SplitN(strings.TrimLeft(text, "\r\n\t "), "\n", 2)[0])
+		isCSV = strings.HasPrefix(strings.ToLower(first), "url,")
+	}
+	if isCSV {
+		return readCSV(text, name)
+	}
+
+	var result []Seed
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		result = append(result, Seed{URL: line})
+	}
+	return result, nil
+}
+
+func readCSV(text, name string) ([]Seed, error) {
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var result []Seed
+	var errs []string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		if len(record) == 0 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if len(result) == 0 && len(errs) == 0 && strings.EqualFold(strings.TrimSpace(record[0]), "url") {
+			continue // Header
+		}
+		if len(record) > 3 {
+			errs = append(errs, fmt.Sprintf("%s:%d: expected url,depth,scope, got %d columns", name, line, len(record)))
+			continue
+		}
+
+		seed := Seed{URL: strings.TrimSpace(record[0])}
+		if len(record) > 1 && strings.TrimSpace(record[1]) != "" {
+			depth, err := strconv.Atoi(strings.TrimSpace(record[1]))
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s:%d: depth must be an integer, got %q", name, line, record[1]))
+				continue
+			}
+			seed.MaxDepth = depth
+		}
+		if len(record) > 2 {
+			seed.Scope = scope.Mode(strings.ToLower(strings.TrimSpace(record[2])))
+		}
+		result = append(result, seed)
+	}
+
+	if len(errs) > 0 {
+		return result, errors.New(strings.Join(errs, "; "))
+	}
+	return result, nil
+}
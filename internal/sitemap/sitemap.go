@@ -0,0 +1,214 @@
+package sitemap
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSitemapBytes is the uncompressed size limit from the sitemaps protocol.
+const maxSitemapBytes = 50 * 1024 * 1024
+
+// URL is a page listed in a sitemap.
+type URL struct {
+	Loc        string
+	LastMod    time.Time // Zero if not given
+	ChangeFreq string    // Empty if not given
+	Priority   float64   // 0.5 if not given
+	Sitemap    string    // Sitemap the URL was listed in
+}
+
+// Score turns the sitemap hints into a scheduling priority between 0 and 1,
+// favouring high priority, recently modified and frequently changing pages.
+func (u URL) Score(now time.Time) float64 {
+	freshness := 0.0
+	if !u.LastMod.IsZero() {
+		switch age := now.Sub(u.LastMod); {
+		case age <= 7*24*time.Hour:
+			freshness = 1.0
+		case age <= 30*24*time.Hour:
+			freshness = 0.6
+		case age <= 365*24*time.Hour:
+			freshness = 0.3
+		}
+	}
+
+	frequency := 0.0
+	switch u.ChangeFreq {
+	case "always", "hourly":
+		frequency = 1.0
+	case "daily":
+		frequency = 0.8
+	case "weekly":
+		frequency = 0.5
+	case "monthly":
+		frequency = 0.2
+	}
+
+	return 0.6*u.Priority + 0.25*freshness + 0.15*frequency
+}
+
+// Getter performs the HTTP requests for sitemaps, so they carry the same
+// user agent as page fetches. Canceling ctx aborts a request.
+type Getter interface {
+	Get(ctx context.Context, url string) (*http.Response, error)
+}
+
+// Fetcher downloads sitemaps and sitemap indexes.
+type Fetcher struct {
+	getter      Getter
+	maxURLs     int
+	maxSitemaps int
+}
+
+// NewFetcher returns a fetcher that stops after maxURLs page URLs or
+// maxSitemaps sitemap documents. Zero means unlimited.
+func NewFetcher(getter Getter, maxURLs, maxSitemaps int) *Fetcher {
+	return &Fetcher{
+		getter:      getter,
+		maxURLs:     maxURLs,
+		maxSitemaps: maxSitemaps,
+	}
+}
+
+// Fetch walks the given sitemaps, following sitemap indexes, and returns
+// the page URLs they list. Sitemaps that fail to load are skipped. Once ctx
+// is done, the URLs found so far are returned.
+func (f *Fetcher) Fetch(ctx context.Context, sitemapURLs []string) []URL {
+	var urls []URL
+	pending := append([]string(nil), sitemapURLs...)
+	visited := make(map[string]bool)
+
+	for len(pending) > 0 && ctx.Err() == nil {
+		if f.maxSitemaps > 0 && len(visited) >= f.maxSitemaps {
+			break
+		}
+
+		sitemapURL := pending[0]
+		pending = pending[1:]
+		if visited[sitemapURL] {
+			continue
+		}
+		visited[sitemapURL] = true
+
+		doc, err := f.fetchDocument(ctx, sitemapURL)
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			fmt.Printf("Error fetching sitemap %s: %v\n", sitemapURL, err)
+			continue
+		}
+
+		for _, child := range doc.Sitemaps {
+			if loc := strings.TrimSpace(child.Loc); loc != "" {
+				pending = append(pending, loc)
+			}
+		}
+
+		for _, entry := range doc.URLs {
+			if f.maxURLs > 0 && len(urls) >= f.maxURLs {
+				return urls
+			}
+			if u, ok := entry.toURL(sitemapURL); ok {
+				urls = append(urls, u)
+			}
+		}
+	}
+
+	return urls
+}
+
+// document covers both <urlset> and <sitemapindex> roots.
+type document struct {
+	XMLName  xml.Name
+	URLs     []entry `xml:"url"`
+	Sitemaps []entry `xml:"sitemap"`
+}
+
+type entry struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod"`
+	ChangeFreq string `xml:"changefreq"`
+	Priority   string `xml:"priority"`
+}
+
+func (e entry) toURL(sitemapURL string) (URL, bool) {
+	loc := strings.TrimSpace(e.Loc)
+	if !strings.HasPrefix(loc, "http://") && !strings.HasPrefix(loc, "https://") {
+		return URL{}, false
+	}
+
+	u := URL{
+		Loc:        loc,
+		LastMod:    parseLastMod(e.LastMod),
+		ChangeFreq: strings.ToLower(strings.TrimSpace(e.ChangeFreq)),
+		Priority:   0.5,
+		Sitemap:    sitemapURL,
+	}
+
+	if p, err := strconv.ParseFloat(strings.TrimSpace(e.Priority), 64); err == nil && p >= 0 && p <= 1 {
+		u.Priority = p
+	}
+
+	return u, true
+}
+
+func (f *Fetcher) fetchDocument(ctx context.Context, sitemapURL string) (*document, error) {
+	resp, err := f.getter.Get(ctx, sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	body, err := decompress(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc document
+	if err := xml.NewDecoder(io.LimitReader(body, maxSitemapBytes)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid sitemap XML: %w", err)
+	}
+
+	switch doc.XMLName.Local {
+	case "urlset", "sitemapindex":
+		return &doc, nil
+	default:
+		return nil, fmt.Errorf("unexpected root element <%s>", doc.XMLName.Local)
+	}
+}
+
+// decompress unwraps gzipped sitemaps. They are detected by their magic bytes
+// since servers label .xml.gz files inconsistently.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+	return br, nil
+}
+
+// parseLastMod accepts the W3C datetime forms allowed by the sitemaps protocol.
+func parseLastMod(value string) time.Time {
+	value = strings.TrimSpace(value)
+	layouts := []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02", "2006-01", "2006"}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,122 @@
+package stats
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"webcrawler/internal/utils"
+)
+
+// HostCounters are the fetch counters of one host.
+type HostCounters struct {
+	Host              string         `json:"host"`
+	Pages             int            `json:"pages"` // Fetches that received a response
+	Errors            int            `json:"errors"`
+	ErrorTypes        map[string]int `json:"errorTypes"` // Failed fetches by reason, such as "timeout" or "http 503"
+	Bytes             int64          `json:"bytes"`
+	AvgLatencySeconds float64        `json:"avgLatencySeconds"`
+	RobotsDenials     int            `json:"robotsDenials"`
+	BudgetSkips       int            `json:"budgetSkips"` // URLs dropped once the host used up its page budget
+	LastFetchAt       time.Time      `json:"lastFetchAt"`
+}
+
+type hostCounters struct {
+	HostCounters
+	latency time.Duration // Total of the fetches with a response
+}
+
+// HostStats counts fetches, errors and robots.txt denials per host.
+type HostStats struct {
+	hosts map[string]*hostCounters
+	mu    sync.Mutex
+}
+
+func NewHostStats() *HostStats {
+	return &HostStats{hosts: make(map[string]*hostCounters)}
+}
+
+// Fetched records a fetch of the URL. statusCode is 0 if no response was
+// received.
+func (s *HostStats) Fetched(rawURL string, latency time.Duration, statusCode int, bytes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counters := s.host(rawURL)
+	counters.LastFetchAt = time.Now()
+	if statusCode == 0 {
+		return
+	}
+	counters.Pages++
+	counters.Bytes += int64(bytes)
+	counters.latency += latency
+	counters.AvgLatencySeconds = (counters.latency / time.Duration(counters.Pages)).Seconds()
+}
+
+// Failed records a failed fetch of the URL and its reason.
+func (s *HostStats) Failed(rawURL, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counters := s.host(rawURL)
+	counters.Errors++
+	counters.ErrorTypes[reason]++
+}
+
+// RobotsDenied records a URL robots.txt disallows.
+func (s *HostStats) RobotsDenied(rawURL string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.host(rawURL).RobotsDenials++
+}
+
+// BudgetSkipped records a URL dropped by the per-host page budget.
+func (s *HostStats) BudgetSkipped(rawURL string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.host(rawURL).BudgetSkips++
+}
+
+// Hosts returns a snapshot of the counters of every host seen so far.
+func (s *HostStats) Hosts() []HostCounters {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]HostCounters, 0, len(s.hosts))
+	for _, counters := range s.hosts {
+		result = append(result, counters.snapshot())
+	}
+	return result
+}
+
+// Host returns a snapshot of one host's counters.
+func (s *HostStats) Host(host string) (HostCounters, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counters, exists := s.hosts[strings.ToLower(host)]
+	if !exists {
+		return HostCounters{}, false
+	}
+	return counters.snapshot(), true
+}
+
+// host returns the counters of the URL's host. The caller holds s.mu.
+func (s *HostStats) host(rawURL string) *hostCounters {
+	host := utils.HostOf(rawURL)
+	counters, exists := s.hosts[host]
+	if !exists {
+		counters = &hostCounters{HostCounters: HostCounters{Host: host, ErrorTypes: make(map[string]int)}}
+		s.hosts[host] = counters
+	}
+	return counters
+}
+
+func (c *hostCounters) snapshot() HostCounters {
+	snapshot := c.HostCounters
+	snapshot.ErrorTypes = make(map[string]int, len(c.ErrorTypes))
+	for reason, count := range c.ErrorTypes {
+		snapshot.ErrorTypes[reason] = count
+	}
+	return snapshot
+}
@@ -2,46 +2,126 @@ package stats
 
 import (
 	"fmt"
+	"sync"
 	"time"
-
-	"webcrawler/internal/queue"
 )
 
+// Totals are a crawl's running counters, from which each sample takes
+// the change since the previous one.
+type Totals struct {
+	Pages     int   // Pages fetched
+	Errors    int   // Failed fetches, retried or given up
+	Bytes     int64 // Bytes downloaded
+	Crawled   int   // URLs taken from the frontier
+	QueueSize int   // URLs waiting in the frontier
+}
+
+// Sample describes one interval of a crawl.
+type Sample struct {
+	Time           time.Time `json:"time"` // End of the interval
+	Pages          int       `json:"pages"`
+	PagesPerMinute float64   `json:"pagesPerMinute"`
+	Errors         int       `json:"errors"`
+	Bytes          int64     `json:"bytes"`
+	Crawled        int       `json:"crawled"` // Total so far
+	QueueSize      int       `json:"queueSize"`
+}
+
+// CrawlerStats keeps the most recent samples of a crawl in a ring buffer,
+// dropping the oldest once it is full.
 type CrawlerStats struct {
-	pagesPerMinute        string // 0 0 \n 1 100
-	crawledRatioPerMinute string
-	startTime             time.Time
+	interval  time.Duration
+	startTime time.Time
+
+	mu      sync.Mutex
+	samples []Sample // Ring buffer, next is the slot written next
+	next    int
+	count   int
+	last    Totals
+	lastAt  time.Time
 }
 
-func NewCrawlerStats() *CrawlerStats {
+// NewCrawlerStats returns stats sampled every interval that keep the
+// samples of the last retention.
+func NewCrawlerStats(interval, retention time.Duration) *CrawlerStats {
+	size := 1
+	if interval > 0 && retention > interval {
+		size = int(retention / interval)
+	}
+	now := time.Now()
 	return &CrawlerStats{
-		pagesPerMinute:        "0 0\n",
-		crawledRatioPerMinute: "0 0\n",
-		startTime:             time.Now(),
+		interval:  interval,
+		startTime: now,
+		samples:   make([]Sample, size),
+		lastAt:    now,
 	}
 }
 
-func (stats *CrawlerStats) Update(crawled *queue.CrawledSet, queue *queue.Queue, t time.Time) {
-	stats.pagesPerMinute = fmt.Sprintf("%f %d\n", time.Since(stats.startTime).Minutes(), crawled.Size())
-	stats.crawledRatioPerMinute = fmt.Sprintf("%f %f\n", time.Since(stats.startTime).Minutes(), float64(crawled.Size())/float64(queue.Size()))
+// Update records a sample ending at t from the crawl's current totals.
+func (stats *CrawlerStats) Update(t time.Time, totals Totals) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	sample := Sample{
+		Time:      t,
+		Pages:     totals.Pages - stats.last.Pages,
+		Errors:    totals.Errors - stats.last.Errors,
+		Bytes:     totals.Bytes - stats.last.Bytes,
+		Crawled:   totals.Crawled,
+		QueueSize: totals.QueueSize,
+	}
+	if minutes := t.Sub(stats.lastAt).Minutes(); minutes > 0 {
+		sample.PagesPerMinute = float64(sample.Pages) / minutes
+	}
+
+	stats.samples[stats.next] = sample
+	stats.next = (stats.next + 1) % len(stats.samples)
+	if stats.count < len(stats.samples) {
+		stats.count++
+	}
+	stats.last = totals
+	stats.lastAt = t
 }
 
-func (stats *CrawlerStats) Print() {
-	fmt.Println("Pages crawled per minute:")
-	fmt.Println(stats.pagesPerMinute)
-	fmt.Println("Crawl to Queued Ratio per minute:")
-	fmt.Println(stats.crawledRatioPerMinute)
+// History returns the samples taken after since, oldest first. A zero since
+// returns all of them.
+func (stats *CrawlerStats) History(since time.Time) []Sample {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	result := make([]Sample, 0, stats.count)
+	start := (stats.next - stats.count + len(stats.samples)) % len(stats.samples)
+	for i := 0; i < stats.count; i++ {
+		sample := stats.samples[(start+i)%len(stats.samples)]
+		if sample.Time.After(since) {
+			result = append(result, sample)
+		}
+	}
+	return result
 }
 
-func (stats *CrawlerStats) GetStartTime() time.Time {
-	return stats.startTime
+// Interval returns how often samples are taken.
+func (stats *CrawlerStats) Interval() time.Duration {
+	return stats.interval
 }
 
-func (stats *CrawlerStats) GetCurrentStats() map[string]interface{} {
-	return map[string]interface{}{
-		"startTime":             stats.startTime,
-		"pagesPerMinute":        stats.pagesPerMinute,
-		"crawledRatioPerMinute": stats.crawledRatioPerMinute,
-		"uptime":                time.Since(stats.startTime),
+// Print prints the last samples, up to ten.
+func (stats *CrawlerStats) Print() {
+	history := stats.History(time.Time{})
+	if len(history) > 10 {
+		history = history[len(history)-10:]
+	}
+	if len(history) == 0 {
+		return
+	}
+
+	fmt.Println("Recent intervals:")
+	fmt.Printf("%-10s %8s %10s %7s %12s %8s\n", "Time", "Pages", "Pages/min", "Errors", "Bytes", "Queue")
+	for _, sample := range history {
+		fmt.Printf("%-10s %8d %10.1f %7d %12d %8d\n", sample.Time.Format(time.TimeOnly), sample.Pages, sample.PagesPerMinute, sample.Errors, sample.Bytes, sample.QueueSize)
 	}
 }
+
+func (stats *CrawlerStats) GetStartTime() time.Time {
+	return stats.startTime
+}
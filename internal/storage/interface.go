@@ -1,12 +1,24 @@
 package storage
 
-import "webcrawler/internal/models"
+import (
+	"context"
+	"time"
+
+	"webcrawler/internal/models"
+	"webcrawler/internal/queue"
+)
 
 type Storage interface {
 	Connect()
-	Disconnect()
-	InsertPage(page models.Page)
-	SearchPages(query string, page, limit int) ([]models.Page, int, error)
-	GetPages(page, limit int) ([]models.Page, int, error)
-	GetTotalPages() (int, error)
+	Disconnect(ctx context.Context)
+	InsertPage(ctx context.Context, page models.Page)
+	DeletePage(ctx context.Context, url string)
+	InsertFailure(ctx context.Context, failure models.FailedFetch)
+	GetPagesDue(ctx context.Context, now time.Time, limit int) ([]models.Page, error)
+	SearchPages(ctx context.Context, query string, page, limit int) ([]models.Page, int, error)
+	GetPages(ctx context.Context, page, limit int) ([]models.Page, int, error)
+	GetTotalPages(ctx context.Context) (int, error)
+	SaveFrontier(ctx context.Context, entries []queue.Entry, crawled []uint64) error
+	LoadFrontier(ctx context.Context) ([]queue.Entry, []uint64, error)
+	DeleteFrontier(ctx context.Context) error
 }
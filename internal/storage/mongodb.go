@@ -2,29 +2,94 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
+	"webcrawler/internal/metrics"
 	"webcrawler/internal/models"
+	"webcrawler/internal/queue"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrNotAccessible is returned when storage is disabled or disconnected.
+var ErrNotAccessible = errors.New("database not accessible")
+
+// frontierBatchSize is how many frontier documents are written at once.
+const frontierBatchSize = 1000
+
 type MongoDB struct {
-	access     bool
-	uri        string
-	client     *mongo.Client
-	collection *mongo.Collection
+	*conn
+	job string // Namespace of a crawl job; empty for all jobs
+}
+
+// conn is the connection state shared by a database and its job views, so
+// connecting or disconnecting through any of them applies to all.
+type conn struct {
+	access         bool
+	uri            string
+	clearOnConnect bool
+	client         *mongo.Client
+	collection     *mongo.Collection
+	failures       *mongo.Collection
+	frontiers      *mongo.Collection // Queued entries of stopped crawls, one per document
+	crawled        *mongo.Collection // Crawled URL hashes of stopped crawls, one per document
+}
+
+// frontierEntry is a queued entry of an unfinished crawl, saved so the
+// crawl can be resumed.
+type frontierEntry struct {
+	Job     string
+	Entry   queue.Entry
+	SavedAt time.Time
+}
+
+// crawledURL is the hash of a URL an unfinished crawl has crawled, stored
+// as int64 since BSON has no unsigned integers.
+type crawledURL struct {
+	Job  string
+	Hash int64
 }
 
 func NewMongoDB(access bool, uri string) *MongoDB {
 	return &MongoDB{
-		access: access,
-		uri:    uri,
+		conn: &conn{
+			access:         access,
+			uri:            uri,
+			clearOnConnect: true,
+		},
+	}
+}
+
+// SetClearOnConnect controls whether Connect deletes previously crawled
+// pages. Recrawls keep them so they can be revisited.
+func (db *MongoDB) SetClearOnConnect(clear bool) {
+	db.clearOnConnect = clear
+}
+
+// Namespace returns a view of the database limited to one crawl job. Pages
+// and failures it stores are tagged with the job, and its queries only see
+// that job's pages. It shares the database's connection.
+func (db *MongoDB) Namespace(job string) *MongoDB {
+	return &MongoDB{conn: db.conn, job: job}
+}
+
+// Job returns the job the view is limited to, or "" for all jobs.
+func (db *MongoDB) Job() string {
+	return db.job
+}
+
+// filter limits a query to the view's job.
+func (db *MongoDB) filter(filter bson.M) bson.M {
+	if db.job != "" {
+		filter["job"] = db.job
 	}
+	return filter
 }
 
 func (db *MongoDB) Connect() {
@@ -35,25 +100,38 @@ func (db *MongoDB) Connect() {
 		}
 		db.client = client
 		db.collection = db.client.Database("webcrawler").Collection("pages")
+		db.failures = db.client.Database("webcrawler").Collection("failures")
+		db.frontiers = db.client.Database("webcrawler").Collection("frontiers")
+		db.crawled = db.client.Database("webcrawler").Collection("crawled")
+		if !db.clearOnConnect {
+			fmt.Println("Database kept - previous pages will be revisited")
+			return
+		}
 		filter := bson.D{{}}
-		// Deletes all documents in the collection
+		// Deletes all pages and failures; saved frontiers are kept so they
+		// can still be resumed
 		db.collection.DeleteMany(context.TODO(), filter)
+		db.failures.DeleteMany(context.TODO(), filter)
 		fmt.Println("Database cleared - all previous pages deleted")
 	}
 }
 
-func (db *MongoDB) Disconnect() {
+func (db *MongoDB) Disconnect(ctx context.Context) {
 	if db.access {
-		db.client.Disconnect(context.TODO())
+		db.client.Disconnect(ctx)
 		db.access = false
 	}
 }
 
-func (db *MongoDB) InsertPage(page models.Page) {
+// InsertPage stores the page, replacing any stored version of the same URL.
+func (db *MongoDB) InsertPage(ctx context.Context, page models.Page) {
 	if db.access {
-		_, err := db.collection.InsertOne(context.TODO(), page)
+		page.Job = db.job
+		opts := options.Replace().SetUpsert(true)
+		_, err := db.collection.ReplaceOne(ctx, db.filter(bson.M{"url": page.Url}), page, opts)
 		if err != nil {
 			fmt.Printf("Error inserting page %s: %v\n", page.Url, err)
+			metrics.StorageError(metrics.OpInsertPage)
 		} else {
 			fmt.Printf("Successfully inserted page: %s\n", page.Url)
 		}
@@ -62,21 +140,66 @@ func (db *MongoDB) InsertPage(page models.Page) {
 	}
 }
 
-func (db *MongoDB) SearchPages(query string, page, limit int) ([]models.Page, int, error) {
+// DeletePage removes the stored page with the given URL, if any.
+func (db *MongoDB) DeletePage(ctx context.Context, url string) {
+	if db.access {
+		_, err := db.collection.DeleteOne(ctx, db.filter(bson.M{"url": url}))
+		if err != nil {
+			fmt.Printf("Error deleting page %s: %v\n", url, err)
+			metrics.StorageError(metrics.OpDeletePage)
+		}
+	}
+}
+
+// GetPagesDue returns up to limit stored pages whose next visit is due,
+// most overdue first.
+func (db *MongoDB) GetPagesDue(ctx context.Context, now time.Time, limit int) ([]models.Page, error) {
 	if !db.access {
-		return nil, 0, fmt.Errorf("database not accessible")
+		return nil, ErrNotAccessible
+	}
+
+	filter := db.filter(bson.M{"nextvisitat": bson.M{"$lte": now}})
+	opts := options.Find().SetSort(bson.M{"nextvisitat": 1}).SetLimit(int64(limit))
+
+	cursor, err := db.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var pages []models.Page
+	err = cursor.All(ctx, &pages)
+	if err != nil {
+		return nil, err
 	}
 
-	ctx := context.TODO()
+	return pages, nil
+}
+
+func (db *MongoDB) InsertFailure(ctx context.Context, failure models.FailedFetch) {
+	if db.access {
+		failure.Job = db.job
+		_, err := db.failures.InsertOne(ctx, failure)
+		if err != nil {
+			fmt.Printf("Error recording failure for %s: %v\n", failure.Url, err)
+			metrics.StorageError(metrics.OpInsertFailure)
+		}
+	}
+}
+
+func (db *MongoDB) SearchPages(ctx context.Context, query string, page, limit int) ([]models.Page, int, error) {
+	if !db.access {
+		return nil, 0, ErrNotAccessible
+	}
 
 	// Create text search filter
-	filter := bson.M{
+	filter := db.filter(bson.M{
 		"$or": []bson.M{
 			{"title": bson.M{"$regex": query, "$options": "i"}},
 			{"content": bson.M{"$regex": query, "$options": "i"}},
 			{"url": bson.M{"$regex": query, "$options": "i"}},
 		},
-	}
+	})
 
 	fmt.Printf("Searching for query: '%s'\n", query)
 	fmt.Printf("Search filter: %+v\n", filter)
@@ -216,15 +339,14 @@ func (db *MongoDB) calculateScore(page models.Page, query string) float64 {
 	return score
 }
 
-func (db *MongoDB) GetPages(page, limit int) ([]models.Page, int, error) {
+func (db *MongoDB) GetPages(ctx context.Context, page, limit int) ([]models.Page, int, error) {
 	if !db.access {
-		return nil, 0, fmt.Errorf("database not accessible")
+		return nil, 0, ErrNotAccessible
 	}
 
-	ctx := context.TODO()
-
 	// Count total documents
-	total, err := db.collection.CountDocuments(ctx, bson.M{})
+	filter := db.filter(bson.M{})
+	total, err := db.collection.CountDocuments(ctx, filter)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -234,7 +356,7 @@ func (db *MongoDB) GetPages(page, limit int) ([]models.Page, int, error) {
 	opts := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit)).SetSort(bson.M{"_id": -1})
 
 	// Get pages
-	cursor, err := db.collection.Find(ctx, bson.M{}, opts)
+	cursor, err := db.collection.Find(ctx, filter, opts)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -249,11 +371,105 @@ func (db *MongoDB) GetPages(page, limit int) ([]models.Page, int, error) {
 	return pages, int(total), nil
 }
 
-func (db *MongoDB) GetTotalPages() (int, error) {
+func (db *MongoDB) GetTotalPages(ctx context.Context) (int, error) {
 	if !db.access {
-		return 0, fmt.Errorf("database not accessible")
+		return 0, ErrNotAccessible
 	}
 
-	count, err := db.collection.CountDocuments(context.TODO(), bson.M{})
+	count, err := db.collection.CountDocuments(ctx, db.filter(bson.M{}))
 	return int(count), err
 }
+
+// SaveFrontier stores the frontier of the view's job, replacing any saved
+// before. Entries and crawled URLs are stored one per document, in batches.
+func (db *MongoDB) SaveFrontier(ctx context.Context, entries []queue.Entry, crawled []uint64) error {
+	if !db.access {
+		return ErrNotAccessible
+	}
+	if err := db.DeleteFrontier(ctx); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err := insertBatches(ctx, db.frontiers, len(entries), func(i int) interface{} {
+		return frontierEntry{Job: db.job, Entry: entries[i], SavedAt: now}
+	})
+	if err != nil {
+		return fmt.Errorf("saving queued URLs: %w", err)
+	}
+	err = insertBatches(ctx, db.crawled, len(crawled), func(i int) interface{} {
+		return crawledURL{Job: db.job, Hash: int64(crawled[i])}
+	})
+	if err != nil {
+		return fmt.Errorf("saving crawled URLs: %w", err)
+	}
+	return nil
+}
+
+// insertBatches inserts count documents made by doc, frontierBatchSize at
+// a time.
+func insertBatches(ctx context.Context, collection *mongo.Collection, count int, doc func(i int) interface{}) error {
+	for start := 0; start < count; start += frontierBatchSize {
+		end := min(start+frontierBatchSize, count)
+		batch := make([]interface{}, 0, end-start)
+		for i := start; i < end; i++ {
+			batch = append(batch, doc(i))
+		}
+		if _, err := collection.InsertMany(ctx, batch, options.InsertMany().SetOrdered(false)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadFrontier returns the saved frontier of the view's job and its crawled
+// URL hashes, or no entries if none was saved.
+func (db *MongoDB) LoadFrontier(ctx context.Context) ([]queue.Entry, []uint64, error) {
+	if !db.access {
+		return nil, nil, ErrNotAccessible
+	}
+
+	cursor, err := db.frontiers.Find(ctx, bson.M{"job": db.job}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, nil, err
+	}
+	var saved []frontierEntry
+	if err := cursor.All(ctx, &saved); err != nil {
+		return nil, nil, err
+	}
+	if len(saved) == 0 {
+		return nil, nil, nil
+	}
+
+	cursor, err = db.crawled.Find(ctx, bson.M{"job": db.job})
+	if err != nil {
+		return nil, nil, err
+	}
+	var hashes []crawledURL
+	if err := cursor.All(ctx, &hashes); err != nil {
+		return nil, nil, err
+	}
+
+	entries := make([]queue.Entry, len(saved))
+	for i, entry := range saved {
+		entries[i] = entry.Entry
+	}
+	crawled := make([]uint64, len(hashes))
+	for i, hash := range hashes {
+		crawled[i] = uint64(hash.Hash)
+	}
+	return entries, crawled, nil
+}
+
+// DeleteFrontier removes the saved frontier of the view's job.
+func (db *MongoDB) DeleteFrontier(ctx context.Context) error {
+	if !db.access {
+		return ErrNotAccessible
+	}
+
+	if _, err := db.frontiers.DeleteMany(ctx, bson.M{"job": db.job}); err != nil {
+		return err
+	}
+	_, err := db.crawled.DeleteMany(ctx, bson.M{"job": db.job})
+	return err
+}
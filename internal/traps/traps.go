@@ -0,0 +1,200 @@
+package traps
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Config holds the thresholds for the trap heuristics. A zero value disables
+// the corresponding check.
+type Config struct {
+	MaxURLLength        int // Characters in the full URL
+	MaxQueryParams      int // Query parameters in one URL
+	MaxRepeatedSegments int // Times one path segment may appear in a path
+	MaxPathDepth        int // Path segments in one URL
+	MaxPerPattern       int // URLs enqueued per host for one URL pattern
+	RejectSessionIDs    bool
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxURLLength:        2048,
+		MaxQueryParams:      8,
+		MaxRepeatedSegments: 3,
+		MaxPathDepth:        15,
+		MaxPerPattern:       200,
+		RejectSessionIDs:    true,
+	}
+}
+
+var (
+	digitRun = regexp.MustCompile(`[0-9]+`)
+
+	sessionParams = map[string]bool{
+		"sid":          true,
+		"sessionid":    true,
+		"session_id":   true,
+		"jsessionid":   true,
+		"phpsessid":    true,
+		"aspsessionid": true,
+		"cfid":         true,
+		"cftoken":      true,
+	}
+)
+
+// Detector rejects URLs that look like they come from an infinite URL space,
+// such as calendars, session IDs or faceted search permutations.
+type Detector struct {
+	cfg      Config
+	patterns map[string]int
+	rejected map[string]int
+	mu       sync.Mutex
+}
+
+func NewDetector(cfg Config) *Detector {
+	return &Detector{
+		cfg:      cfg,
+		patterns: make(map[string]int),
+		rejected: make(map[string]int),
+	}
+}
+
+// Admit reports whether the URL is safe to enqueue, and if not, why. An
+// admitted URL counts towards its pattern cap until it is released.
+func (d *Detector) Admit(rawURL string) (bool, string) {
+	parsedURL, reason := d.reason(rawURL)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if reason == "" && d.cfg.MaxPerPattern > 0 {
+		pattern := Pattern(parsedURL)
+		if count := d.patterns[pattern]; count >= d.cfg.MaxPerPattern {
+			reason = fmt.Sprintf("pattern cap: %d URLs already queued for %s", count, pattern)
+		} else {
+			d.patterns[pattern]++
+		}
+	}
+	if reason != "" {
+		d.rejected[strings.SplitN(reason, ":", 2)[0]]++
+		return false, reason
+	}
+	return true, ""
+}
+
+// Release gives back the pattern cap share of an admitted URL that was not
+// enqueued after all.
+func (d *Detector) Release(rawURL string) {
+	if d.cfg.MaxPerPattern <= 0 {
+		return
+	}
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	pattern := Pattern(parsedURL)
+	if d.patterns[pattern] > 0 {
+		d.patterns[pattern]--
+	}
+}
+
+// Rejected returns how many URLs each heuristic has rejected.
+func (d *Detector) Rejected() map[string]int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := make(map[string]int, len(d.rejected))
+	for reason, count := range d.rejected {
+		result[reason] = count
+	}
+	return result
+}
+
+// reason returns why the URL's shape looks like a trap, or "" if it does
+// not. The pattern cap is left to Admit.
+func (d *Detector) reason(rawURL string) (*url.URL, string) {
+	if d.cfg.MaxURLLength > 0 && len(rawURL) > d.cfg.MaxURLLength {
+		return nil, fmt.Sprintf("url too long: %d characters", len(rawURL))
+	}
+
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "unparseable url"
+	}
+
+	query := parsedURL.Query()
+	params := 0
+	for key, values := range query {
+		params += len(values)
+		if d.cfg.RejectSessionIDs && sessionParams[strings.ToLower(key)] {
+			return nil, fmt.Sprintf("session id: query parameter %q", key)
+		}
+	}
+	if d.cfg.MaxQueryParams > 0 && params > d.cfg.MaxQueryParams {
+		return nil, fmt.Sprintf("too many query params: %d", params)
+	}
+
+	if d.cfg.RejectSessionIDs && strings.Contains(strings.ToLower(parsedURL.Path), ";jsessionid=") {
+		return nil, "session id: jsessionid path parameter"
+	}
+
+	segments := pathSegments(parsedURL.Path)
+	if d.cfg.MaxPathDepth > 0 && len(segments) > d.cfg.MaxPathDepth {
+		return nil, fmt.Sprintf("path too deep: %d segments", len(segments))
+	}
+
+	if d.cfg.MaxRepeatedSegments > 0 {
+		counts := make(map[string]int)
+		for _, segment := range segments {
+			counts[segment]++
+			if counts[segment] > d.cfg.MaxRepeatedSegments {
+				return nil, fmt.Sprintf("repeated path segment: %q appears %d times", segment, counts[segment])
+			}
+		}
+	}
+
+	return parsedURL, ""
+}
+
+// Pattern collapses a URL into a shape shared by its near-duplicates: digit
+// runs become {n} and query values are dropped, keeping sorted parameter
+// names. For example, https://Example.com/2024/05/events?page=3&sort=asc
+// becomes example.com/{n}/{n}/events?page&sort.
+func Pattern(parsedURL *url.URL) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(parsedURL.Host))
+
+	for _, segment := range pathSegments(parsedURL.Path) {
+		b.WriteString("/")
+		b.WriteString(digitRun.ReplaceAllString(segment, "{n}"))
+	}
+
+	query := parsedURL.Query()
+	if len(query) > 0 {
+		keys := make([]string, 0, len(query))
+		for key := range query {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b.WriteString("?")
+		b.WriteString(strings.Join(keys, "&"))
+	}
+
+	return b.String()
+}
+
+func pathSegments(path string) []string {
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
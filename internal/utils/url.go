@@ -14,6 +14,16 @@ func HashUrl(url string) uint64 {
 	return h.Sum64()
 }
 
+// HostOf returns the lowercase host name of a URL without its port, the key
+// of all per-host state. It returns "" if the URL can't be parsed.
+func HostOf(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsedURL.Hostname())
+}
+
 func GetHref(t html.Token, baseURL string) (ok bool, href string) {
 	for _, a := range t.Attr {
 		if a.Key == "href" {